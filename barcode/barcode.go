@@ -7,6 +7,7 @@ package barcode
 
 import (
 	"fmt"
+	"html"
 )
 
 type KIND int
@@ -45,6 +46,7 @@ func GetBarcodeSVG(code string, kind KIND, w, h float64, color string, hri HRI,
 	if err != nil {
 		return "", err
 	}
+	legend = html.EscapeString(legend)
 	var svg string
 	if !inline {
 		svg += "<?xml version=\"1.0\" standalone=\"no\" ?>\n"
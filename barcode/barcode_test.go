@@ -2,8 +2,10 @@ package barcode_test
 
 import (
 	"fmt"
+	"testing"
 
 	"github.com/horus-es/go-util/v3/barcode"
+	"github.com/stretchr/testify/assert"
 )
 
 func ExampleGetBarcodeBARS() {
@@ -45,3 +47,14 @@ func ExampleGetBarcodeSVG() {
 	// 	</g>
 	// </svg>
 }
+
+func TestGetBarcodeSVGEscapado(t *testing.T) {
+	// El texto HRI se escapa: el SVG se embebe en HTML
+	svg, err := barcode.GetBarcodeSVG("<script>x&y</script>", barcode.C128X, 2, 100, "#000", barcode.Both, true)
+	assert.NoError(t, err)
+	assert.NotContains(t, svg, "<script>")
+	assert.Contains(t, svg, ">&lt;script&gt;x&amp;y&lt;/script&gt;</text>")
+	// Code39 no admite estos caracteres
+	_, err = barcode.GetBarcodeSVG("A<B&C", barcode.C39, 2, 100, "#000", barcode.Below, true)
+	assert.Error(t, err)
+}
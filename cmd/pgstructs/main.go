@@ -0,0 +1,59 @@
+// Genera los structs T_tabla de las tablas de un esquema POSTGRESQL, para usar con el paquete postgres.
+/*
+Uso:
+
+	pgstructs [-dsn cadena] [-schema esquema] [-pkg paquete] [-o fichero] [tabla ...]
+
+Normalmente se invoca desde una directiva go:generate, p.e.:
+
+	//go:generate go run github.com/horus-es/go-util/v3/cmd/pgstructs -o tablas.go personal operadores
+
+Si no se indica -dsn se usa la variable de entorno DATABASE_URL. Si no se indica -pkg se usa la variable
+de entorno GOPACKAGE, que establece go generate. Sin tablas se generan todas las del esquema.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/horus-es/go-util/v3/postgres"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "cadena de conexión a la base de datos")
+	schema := flag.String("schema", "public", "esquema de las tablas")
+	pkg := flag.String("pkg", os.Getenv("GOPACKAGE"), "paquete del código generado")
+	out := flag.String("o", "", "fichero de salida, por defecto STDOUT")
+	flag.Parse()
+	if *dsn == "" || *pkg == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	err := genera(*dsn, *schema, *pkg, *out, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "pgstructs:", err)
+		os.Exit(1)
+	}
+}
+
+func genera(dsn, schema, pkg, out string, tablas []string) (err error) {
+	defer func() {
+		if causa := recover(); causa != nil {
+			err = fmt.Errorf("%v", causa)
+		}
+	}()
+	postgres.InitPool(dsn, nil)
+	// Contexto propio para que el log de las consultas no se mezcle con la salida
+	fuente, err := postgres.GenerateStructs(&gin.Context{}, pkg, schema, tablas...)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(fuente)
+		return err
+	}
+	return os.WriteFile(out, fuente, 0666)
+}
@@ -4,6 +4,7 @@ go 1.25.0
 
 require (
 	github.com/beevik/etree v1.6.0
+	github.com/boombuler/barcode v1.1.0
 	github.com/davrux/go-smtptester v1.0.2
 	github.com/georgysavva/scany/v2 v2.1.4
 	github.com/gin-contrib/cors v1.7.7
@@ -13,6 +14,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.11.1
 	github.com/vanng822/go-premailer v1.34.0
+	golang.org/x/image v0.25.0
 	golang.org/x/text v0.37.0
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
 )
@@ -0,0 +1,234 @@
+// Cola de trabajos persistente en POSTGRESQL
+/*
+Los trabajos se graban en la tabla jobs, dentro de la transacción en curso si la hay, para ejecutarse
+inmediatamente o en una fecha programada. Los workers reclaman los trabajos con "for update skip locked",
+de forma que varios procesos pueden compartir la cola sin ejecutar dos veces el mismo trabajo.
+
+Cada trabajo se ejecuta dentro de su propia transacción: si falla, se deshacen sus cambios y se reintenta
+con espera exponencial hasta agotar los intentos, quedando entonces en estado FALLIDO.
+La actividad de cada trabajo se registra como un bloque en el logger, igual que una solicitud gin.
+
+La tabla se crea con la orden SQL de la constante DDL.
+*/
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/logger"
+	"github.com/horus-es/go-util/v3/postgres"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Orden SQL de creación de la tabla jobs
+const DDL = `create table if not exists jobs (
+	id uuid primary key default gen_random_uuid(),
+	tipo text not null,
+	datos jsonb not null,
+	estado text not null default 'PENDIENTE',
+	intentos integer not null default 0,
+	ejecutar timestamptz not null default now(),
+	inicio timestamptz,
+	error text,
+	creado timestamptz not null default now(),
+	finalizado timestamptz
+);
+create index if not exists jobs_pendientes on jobs (ejecutar) where estado in ('PENDIENTE','EJECUTANDO');`
+
+// Estados de los trabajos
+const (
+	PENDIENTE  = "PENDIENTE"  // Pendiente de ejecución o de reintento
+	EJECUTANDO = "EJECUTANDO" // En ejecución
+	HECHO      = "HECHO"      // Ejecutado correctamente
+	FALLIDO    = "FALLIDO"    // Reintentos agotados
+)
+
+// Fila de la tabla jobs
+type t_jobs struct {
+	ID         string
+	Tipo       string
+	Datos      []byte
+	Estado     string
+	Intentos   int
+	Ejecutar   time.Time
+	Inicio     pgtype.Timestamptz
+	Error      pgtype.Text
+	Creado     time.Time
+	Finalizado pgtype.Timestamptz
+}
+
+// Función que ejecuta un trabajo. Recibe los datos tal y como se pasaron a Enqueue, codificados en JSON.
+// El contexto sirve para registrar la actividad y para las funciones del paquete postgres, que se ejecutan en la transacción del trabajo.
+// Si devuelve un error o se produce un panic, la transacción se aborta y el trabajo se reintenta más tarde.
+type Handler func(c *gin.Context, datos []byte) error
+
+// Configuración de los workers
+type Config struct {
+	Workers     int           // Número de workers, por defecto 1
+	Intervalo   time.Duration // Intervalo de consulta de trabajos pendientes, por defecto 5 segundos
+	MaxIntentos int           // Número máximo de intentos antes de pasar a FALLIDO, por defecto 10
+	Espera      time.Duration // Espera tras el primer fallo, que se duplica en cada reintento. Por defecto 1 minuto
+	EsperaMax   time.Duration // Espera máxima entre reintentos, por defecto 1 hora
+	Timeout     time.Duration // Tiempo tras el cual un trabajo EJECUTANDO se considera abandonado (p.e. por caída del proceso) y se reclama de nuevo. Por defecto 1 hora
+}
+
+var handlers = map[string]Handler{}
+var handlersMutex sync.RWMutex
+
+// Registra la función que ejecuta un tipo de trabajo
+func Register(tipo string, handler Handler) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers[tipo] = handler
+}
+
+// Graba un trabajo para su ejecución inmediata, dentro de la transacción en curso si la hay.
+// Los datos se codifican en JSON. Devuelve el id del trabajo.
+// Panic si el tipo no está registrado o los datos no se pueden codificar.
+func Enqueue(c *gin.Context, tipo string, datos any) string {
+	return enqueue(c, t_jobs{Tipo: tipo}, datos, "tipo", "datos")
+}
+
+// Graba un trabajo para su ejecución a partir de una fecha, dentro de la transacción en curso si la hay.
+// Los datos se codifican en JSON. Devuelve el id del trabajo.
+// Panic si el tipo no está registrado o los datos no se pueden codificar.
+func EnqueueAt(c *gin.Context, tipo string, datos any, ejecutar time.Time) string {
+	return enqueue(c, t_jobs{Tipo: tipo, Ejecutar: ejecutar}, datos, "tipo", "datos", "ejecutar")
+}
+
+// Auxiliar de Enqueue y EnqueueAt
+func enqueue(c *gin.Context, job t_jobs, datos any, campos ...string) string {
+	handlersMutex.RLock()
+	_, ok := handlers[job.Tipo]
+	handlersMutex.RUnlock()
+	errores.PanicIfTrue(!ok, "jobs: tipo %q no registrado", job.Tipo)
+	var err error
+	job.Datos, err = json.Marshal(datos)
+	errores.PanicIfError(err, "jobs: %s", job.Tipo)
+	return postgres.InsertRow(c, job, campos...)
+}
+
+// Inicia los workers en segundo plano, hasta que se cancele ctx.
+// Pueden ejecutarse workers a la vez en distintos procesos.
+// Si el logger es nil, se usa el logger por defecto.
+func StartWorkers(ctx context.Context, cfg Config, log *logger.Logger) {
+	cfg = porDefecto(cfg)
+	for range cfg.Workers {
+		go func() {
+			ticker := time.NewTicker(cfg.Intervalo)
+			defer ticker.Stop()
+			for {
+				for ctx.Err() == nil && Work(cfg, log) {
+					// Puede haber más trabajos pendientes
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}()
+	}
+}
+
+// Reclama y ejecuta un trabajo pendiente. Devuelve false si no hay ninguno.
+// Normalmente se usa StartWorkers, que la invoca periódicamente.
+func Work(cfg Config, log *logger.Logger) (found bool) {
+	cfg = porDefecto(cfg)
+	c := &gin.Context{}
+	defer func() {
+		if causa := recover(); causa != nil {
+			log.Errorf(c, "panic: %v\n%s", causa, debug.Stack())
+			log.Flush(c)
+		} else if found {
+			log.Flush(c)
+		}
+	}()
+	var job t_jobs
+	found = postgres.GetOneOrZeroRows(c, &job, `update jobs set estado=$1, intentos=intentos+1, inicio=now()
+		where id=(select id from jobs where (estado=$2 and ejecutar<=now()) or (estado=$1 and inicio<now()-make_interval(secs => $3))
+		order by ejecutar limit 1 for update skip locked) returning *`, EJECUTANDO, PENDIENTE, cfg.Timeout.Seconds())
+	if !found {
+		return
+	}
+	ts := time.Now()
+	log.Infof(c, "jobs: %s %s intento %d", job.Tipo, job.ID, job.Intentos)
+	err := ejecuta(c, job)
+	if err == nil {
+		log.Infof(c, "jobs: %s %s hecho: %dms", job.Tipo, job.ID, time.Since(ts).Milliseconds())
+		return
+	}
+	job.Error = pgtype.Text{String: err.Error(), Valid: true}
+	if job.Intentos >= cfg.MaxIntentos {
+		job.Estado = FALLIDO
+		postgres.UpdateRow(c, job, "estado", "error", "finalizado=now()")
+		log.Errorf(c, "jobs: %s %s fallido tras %d intentos: %v", job.Tipo, job.ID, job.Intentos, err)
+		return
+	}
+	espera := cfg.EsperaMax
+	if job.Intentos <= 20 {
+		espera = min(cfg.Espera<<(job.Intentos-1), cfg.EsperaMax)
+	}
+	job.Estado = PENDIENTE
+	postgres.UpdateRow(c, job, "estado", "error", fmt.Sprintf("ejecutar=now()+interval '%d seconds'", int(espera.Seconds())))
+	log.Warnf(c, "jobs: %s %s intento %d fallido, reintento en %s: %v", job.Tipo, job.ID, job.Intentos, espera, err)
+	return
+}
+
+// Ejecuta un trabajo en su propia transacción y lo marca como HECHO. Los panics se convierten en errores.
+func ejecuta(c *gin.Context, job t_jobs) (err error) {
+	defer func() {
+		if causa := recover(); causa != nil {
+			err = fmt.Errorf("panic: %v", causa)
+		}
+		if err != nil {
+			postgres.RollbackTX(c)
+		}
+	}()
+	handlersMutex.RLock()
+	handler, ok := handlers[job.Tipo]
+	handlersMutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("tipo %q no registrado", job.Tipo)
+	}
+	postgres.StartTX(c)
+	err = handler(c, job.Datos)
+	if err != nil {
+		return
+	}
+	job.Estado = HECHO
+	job.Error = pgtype.Text{}
+	postgres.UpdateRow(c, job, "estado", "error", "finalizado=now()")
+	postgres.CommitTX(c)
+	return
+}
+
+// Completa la configuración con los valores por defecto
+func porDefecto(cfg Config) Config {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.Intervalo <= 0 {
+		cfg.Intervalo = 5 * time.Second
+	}
+	if cfg.MaxIntentos <= 0 {
+		cfg.MaxIntentos = 10
+	}
+	if cfg.Espera <= 0 {
+		cfg.Espera = time.Minute
+	}
+	if cfg.EsperaMax <= 0 {
+		cfg.EsperaMax = time.Hour
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = time.Hour
+	}
+	return cfg
+}
@@ -0,0 +1,94 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/jobs"
+	"github.com/horus-es/go-util/v3/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	postgres.InitPool(`
+	    host=devel.horus.es
+		port=43210
+		user=SPARK2
+		password=lahh4jaequ2I
+		dbname=SPARK2
+		sslmode=disable
+		application_name=_TEST_`, nil)
+}
+
+// Crea la tabla jobs si no existe
+func creaTabla(t *testing.T) {
+	conn, err := postgres.AcquireConnection()
+	errores.PanicIfError(err)
+	defer postgres.ReleaseConnection(conn)
+	_, err = conn.Exec(context.Background(), jobs.DDL)
+	assert.NoError(t, err)
+}
+
+func TestEnqueueUnknown(t *testing.T) {
+	defer func() { recover() }()
+	jobs.Enqueue(nil, "desconocido", "datos")
+	t.Error("Sin pánico con tipo no registrado")
+}
+
+func TestWork(t *testing.T) {
+	creaTabla(t)
+	hechos := []string{}
+	jobs.Register("test-work", func(c *gin.Context, datos []byte) error {
+		hechos = append(hechos, string(datos))
+		return nil
+	})
+	cfg := jobs.Config{}
+
+	// Trabajo en transacción abortada: no se ejecuta nunca
+	postgres.StartTX(nil)
+	jobs.Enqueue(nil, "test-work", "abortado")
+	postgres.RollbackTX(nil)
+
+	// Trabajo inmediato y trabajo programado
+	postgres.StartTX(nil)
+	jobs.Enqueue(nil, "test-work", "inmediato")
+	jobs.EnqueueAt(nil, "test-work", "programado", time.Now().Add(time.Second))
+	postgres.CommitTX(nil)
+
+	for jobs.Work(cfg, nil) {
+	}
+	assert.Equal(t, []string{`"inmediato"`}, hechos)
+	time.Sleep(1500 * time.Millisecond)
+	for jobs.Work(cfg, nil) {
+	}
+	assert.Equal(t, []string{`"inmediato"`, `"programado"`}, hechos)
+}
+
+func TestRetry(t *testing.T) {
+	creaTabla(t)
+	intentos := 0
+	jobs.Register("test-retry", func(c *gin.Context, datos []byte) error {
+		intentos++
+		if intentos == 1 {
+			return errors.New("error transitorio")
+		}
+		panic("error permanente")
+	})
+	cfg := jobs.Config{MaxIntentos: 2, Espera: time.Second}
+	jobs.Enqueue(nil, "test-retry", nil)
+	for jobs.Work(cfg, nil) {
+	}
+	assert.Equal(t, 1, intentos)
+	time.Sleep(1500 * time.Millisecond)
+	for jobs.Work(cfg, nil) {
+	}
+	assert.Equal(t, 2, intentos)
+	time.Sleep(1500 * time.Millisecond)
+	for jobs.Work(cfg, nil) {
+	}
+	assert.Equal(t, 2, intentos)
+}
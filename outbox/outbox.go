@@ -0,0 +1,297 @@
+// Bandeja de salida transaccional (transactional outbox) para correos y llamadas REST
+/*
+Los mensajes se graban en la tabla outbox dentro de la transacción en curso (p.e. la de MiddlewareTransaction),
+de forma que si la transacción se aborta el mensaje nunca se envía. Un distribuidor en segundo plano
+entrega los mensajes una vez confirmada la transacción, reintentando los fallos con espera exponencial.
+Los mensajes que agotan los reintentos quedan en estado MUERTO (dead-letter) para su revisión manual.
+
+La tabla se crea con la orden SQL de la constante DDL.
+*/
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/logger"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/horus-es/go-util/v3/postgres"
+	"github.com/horus-es/go-util/v3/rest"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Orden SQL de creación de la tabla outbox
+const DDL = `create table if not exists outbox (
+	id uuid primary key default gen_random_uuid(),
+	tipo text not null,
+	mensaje jsonb not null,
+	estado text not null default 'PENDIENTE',
+	intentos integer not null default 0,
+	proximo timestamp not null default now(),
+	error text,
+	creado timestamp not null default now(),
+	enviado timestamp
+);
+create index if not exists outbox_pendientes on outbox (proximo) where estado = 'PENDIENTE';`
+
+// Estados de los mensajes
+const (
+	PENDIENTE = "PENDIENTE" // Pendiente de entrega o de reintento
+	ENVIADO   = "ENVIADO"   // Entregado
+	MUERTO    = "MUERTO"    // Reintentos agotados (dead-letter)
+)
+
+// Tipos de mensaje predefinidos
+const (
+	MAIL      = "mail"      // Correo, ver EnqueueXhtmlMail
+	REST_POST = "rest-post" // Llamada REST, ver EnqueueRestPost
+)
+
+// Fila de la tabla outbox
+type t_outbox struct {
+	ID       string
+	Tipo     string
+	Mensaje  []byte
+	Estado   string
+	Intentos int
+	Proximo  pgtype.Timestamp
+	Error    pgtype.Text
+	Creado   pgtype.Timestamp
+	Enviado  pgtype.Timestamp
+}
+
+// Mensaje de tipo MAIL
+type Mail struct {
+	Body     string   // Documento HTML
+	Adjuntos []string // Ficheros a adjuntar, deben existir en el momento de la entrega
+	From     string
+	To       string
+	Subject  string
+	Bcc      []string `json:",omitempty"`
+	ReplyTo  []string `json:",omitempty"`
+}
+
+// Mensaje de tipo REST_POST
+type RestPost struct {
+	Host     string
+	Endpoint string
+	Request  json.RawMessage
+	Headers  []string `json:",omitempty"`
+}
+
+// Configuración del distribuidor
+type Config struct {
+	Intervalo   time.Duration // Intervalo de consulta de mensajes pendientes, por defecto 5 segundos
+	Lote        int           // Número máximo de mensajes por consulta, por defecto 10
+	MaxIntentos int           // Número máximo de intentos antes de pasar a MUERTO, por defecto 10
+	Espera      time.Duration // Espera tras el primer fallo, que se duplica en cada reintento. Por defecto 1 minuto
+	EsperaMax   time.Duration // Espera máxima entre reintentos, por defecto 1 hora
+	Timeout     time.Duration // Tiempo durante el que un lote reclamado queda reservado a su distribuidor. Pasado este tiempo, los mensajes no registrados como entregados se reclaman de nuevo. Por defecto 10 minutos
+	// Parámetros SMTP de los mensajes MAIL. La contraseña debe ir codificada en base64.
+	SmtpHost     string
+	SmtpPort     int
+	SmtpUsername string
+	SmtpPassword string
+}
+
+var handlers = map[string]func(cfg Config, mensaje []byte) error{
+	MAIL:      entregaMail,
+	REST_POST: entregaRestPost,
+}
+var handlersMutex sync.RWMutex
+
+// Registra la función de entrega de un tipo de mensaje propio.
+// La función recibe el mensaje tal y como se pasó a Enqueue, codificado en JSON.
+func RegisterHandler(tipo string, handler func(mensaje []byte) error) {
+	handlersMutex.Lock()
+	defer handlersMutex.Unlock()
+	handlers[tipo] = func(cfg Config, mensaje []byte) error {
+		return handler(mensaje)
+	}
+}
+
+// Graba un mensaje en la bandeja de salida, dentro de la transacción en curso si la hay.
+// El mensaje se codifica en JSON. Devuelve el id del mensaje.
+// Panic si el tipo no está registrado o el mensaje no se puede codificar.
+func Enqueue(c *gin.Context, tipo string, mensaje any) string {
+	handlersMutex.RLock()
+	_, ok := handlers[tipo]
+	handlersMutex.RUnlock()
+	errores.PanicIfTrue(!ok, "outbox: tipo %q no registrado", tipo)
+	datos, err := json.Marshal(mensaje)
+	errores.PanicIfError(err, "outbox: %s", tipo)
+	return postgres.InsertRow(c, t_outbox{Tipo: tipo, Mensaje: datos}, "tipo", "mensaje")
+}
+
+// Fusiona una plantilla XHTML y graba el correo resultante en la bandeja de salida,
+// dentro de la transacción en curso si la hay. Los parámetros son los de plantillas.SendXhtmlMail,
+// salvo los SMTP, que se toman de la configuración del distribuidor. Devuelve el id del mensaje.
+func EnqueueXhtmlMail(c *gin.Context, name, xhtml string, datos any, assets string, ff formato.Fecha, fp formato.Moneda, adjuntos []string,
+	from, to, subject string, bcc, replyto []string) (string, error) {
+	body, err := plantillas.MergeXhtmlTemplate(name, xhtml, datos, assets, ff, fp)
+	if err != nil {
+		return "", err
+	}
+	mail := Mail{Body: body, Adjuntos: adjuntos, From: from, To: to, Subject: subject, Bcc: bcc, ReplyTo: replyto}
+	return Enqueue(c, MAIL, mail), nil
+}
+
+// Graba una llamada REST POST en la bandeja de salida, dentro de la transacción en curso si la hay.
+// Los parámetros son los de rest.DoRestPost. Devuelve el id del mensaje.
+// La llamada se considera entregada si el código HTTP de la respuesta es 2xx.
+func EnqueueRestPost(c *gin.Context, host, endpoint string, request any, headers ...string) string {
+	r, err := json.Marshal(request)
+	errores.PanicIfError(err, "outbox: %s", REST_POST)
+	return Enqueue(c, REST_POST, RestPost{Host: host, Endpoint: endpoint, Request: r, Headers: headers})
+}
+
+// Inicia el distribuidor de mensajes en segundo plano, hasta que se cancele ctx.
+// Pueden ejecutarse varios distribuidores a la vez, incluso en distintos procesos.
+// Si el logger es nil, se usa el logger por defecto.
+func StartDispatcher(ctx context.Context, cfg Config, log *logger.Logger) {
+	cfg = porDefecto(cfg)
+	go func() {
+		ticker := time.NewTicker(cfg.Intervalo)
+		defer ticker.Stop()
+		for {
+			for Dispatch(cfg, log) == cfg.Lote {
+				// Lote completo: puede haber más mensajes pendientes
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Entrega un lote de mensajes pendientes. Devuelve el número de mensajes procesados.
+// Normalmente se usa StartDispatcher, que la invoca periódicamente.
+// El lote se reclama aplazando sus mensajes cfg.Timeout, y cada mensaje se entrega y se registra fuera de transacción,
+// sin retener bloqueos durante las llamadas SMTP o REST.
+// La entrega es "al menos una vez": si el proceso se interrumpe durante un lote, sus mensajes se volverán a entregar
+// una vez vencido cfg.Timeout.
+func Dispatch(cfg Config, log *logger.Logger) (n int) {
+	cfg = porDefecto(cfg)
+	c := &gin.Context{}
+	defer func() {
+		if causa := recover(); causa != nil {
+			log.Errorf(c, "panic: %v\n%s", causa, debug.Stack())
+			log.Flush(c)
+		} else if n > 0 {
+			log.Flush(c)
+		}
+	}()
+	var lote []t_outbox
+	postgres.GetOrderedRows(c, &lote, `with reclamados as (update outbox set proximo=now()+make_interval(secs => $3)
+		where id in (select id from outbox where estado=$1 and proximo<=now() order by proximo limit $2 for update skip locked)
+		returning *) select * from reclamados order by creado`, PENDIENTE, cfg.Lote, cfg.Timeout.Seconds())
+	n = len(lote)
+	for _, m := range lote {
+		entrega(c, cfg, log, m)
+	}
+	return
+}
+
+// Completa la configuración con los valores por defecto
+func porDefecto(cfg Config) Config {
+	if cfg.Intervalo <= 0 {
+		cfg.Intervalo = 5 * time.Second
+	}
+	if cfg.Lote <= 0 {
+		cfg.Lote = 10
+	}
+	if cfg.MaxIntentos <= 0 {
+		cfg.MaxIntentos = 10
+	}
+	if cfg.Espera <= 0 {
+		cfg.Espera = time.Minute
+	}
+	if cfg.EsperaMax <= 0 {
+		cfg.EsperaMax = time.Hour
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Minute
+	}
+	return cfg
+}
+
+// Entrega un mensaje y actualiza su estado
+func entrega(c *gin.Context, cfg Config, log *logger.Logger, m t_outbox) {
+	handlersMutex.RLock()
+	handler, ok := handlers[m.Tipo]
+	handlersMutex.RUnlock()
+	var err error
+	if ok {
+		err = protege(func() error { return handler(cfg, m.Mensaje) })
+	} else {
+		err = fmt.Errorf("tipo %q no registrado", m.Tipo)
+	}
+	m.Intentos++
+	if err == nil {
+		m.Estado = ENVIADO
+		m.Error = pgtype.Text{}
+		postgres.UpdateRow(c, m, "estado", "intentos", "error", "enviado=now()")
+		log.Infof(c, "outbox: %s %s enviado", m.Tipo, m.ID)
+		return
+	}
+	m.Error = pgtype.Text{String: err.Error(), Valid: true}
+	if m.Intentos >= cfg.MaxIntentos {
+		m.Estado = MUERTO
+		postgres.UpdateRow(c, m, "estado", "intentos", "error")
+		log.Errorf(c, "outbox: %s %s descartado tras %d intentos: %v", m.Tipo, m.ID, m.Intentos, err)
+		return
+	}
+	espera := cfg.EsperaMax
+	if m.Intentos <= 20 {
+		espera = min(cfg.Espera<<(m.Intentos-1), cfg.EsperaMax)
+	}
+	postgres.UpdateRow(c, m, "intentos", "error", fmt.Sprintf("proximo=now()+interval '%d seconds'", int(espera.Seconds())))
+	log.Warnf(c, "outbox: %s %s intento %d fallido, reintento en %s: %v", m.Tipo, m.ID, m.Intentos, espera, err)
+}
+
+// Ejecuta f convirtiendo los panics en errores
+func protege(f func() error) (err error) {
+	defer func() {
+		if causa := recover(); causa != nil {
+			err = fmt.Errorf("panic: %v", causa)
+		}
+	}()
+	return f()
+}
+
+// Entrega un mensaje MAIL
+func entregaMail(cfg Config, mensaje []byte) error {
+	var m Mail
+	err := json.Unmarshal(mensaje, &m)
+	if err != nil {
+		return err
+	}
+	return plantillas.SendHtmlMail(m.Body, m.Adjuntos, m.From, m.To, m.Subject, m.Bcc, m.ReplyTo,
+		cfg.SmtpHost, cfg.SmtpPort, cfg.SmtpUsername, cfg.SmtpPassword)
+}
+
+// Entrega un mensaje REST_POST
+func entregaRestPost(cfg Config, mensaje []byte) error {
+	var m RestPost
+	err := json.Unmarshal(mensaje, &m)
+	if err != nil {
+		return err
+	}
+	_, code, err := rest.DoRestPost[json.RawMessage](m.Host, m.Endpoint, m.Request, m.Headers...)
+	if err != nil {
+		return err
+	}
+	if code < 200 || code > 299 {
+		return fmt.Errorf("HTTP %d", code)
+	}
+	return nil
+}
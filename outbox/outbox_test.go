@@ -0,0 +1,102 @@
+package outbox_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/outbox"
+	"github.com/horus-es/go-util/v3/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	postgres.InitPool(`
+	    host=devel.horus.es
+		port=43210
+		user=SPARK2
+		password=lahh4jaequ2I
+		dbname=SPARK2
+		sslmode=disable
+		application_name=_TEST_`, nil)
+}
+
+// Crea la tabla outbox si no existe
+func creaTabla(t *testing.T) {
+	conn, err := postgres.AcquireConnection()
+	errores.PanicIfError(err)
+	defer postgres.ReleaseConnection(conn)
+	_, err = conn.Exec(context.Background(), outbox.DDL)
+	assert.NoError(t, err)
+}
+
+func TestEnqueueUnknown(t *testing.T) {
+	defer func() { recover() }()
+	outbox.Enqueue(nil, "desconocido", "mensaje")
+	t.Error("Sin pánico con tipo no registrado")
+}
+
+func TestRestPost(t *testing.T) {
+	creaTabla(t)
+	recibidos := make(chan string, 10)
+	fallos := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if fallos > 0 {
+			// El primer intento falla
+			fallos--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		recibidos <- body["factura"]
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	cfg := outbox.Config{Espera: time.Second}
+
+	// Mensaje en transacción abortada: no se envía nunca
+	postgres.StartTX(nil)
+	outbox.EnqueueRestPost(nil, server.URL, "/callback", map[string]string{"factura": "A000000122"})
+	postgres.RollbackTX(nil)
+
+	// Mensaje en transacción confirmada: se envía tras el reintento
+	postgres.StartTX(nil)
+	outbox.EnqueueRestPost(nil, server.URL, "/callback", map[string]string{"factura": "A000000123"})
+	postgres.CommitTX(nil)
+
+	for outbox.Dispatch(cfg, nil) > 0 {
+	}
+	assert.Empty(t, recibidos)
+	time.Sleep(1500 * time.Millisecond)
+	for outbox.Dispatch(cfg, nil) > 0 {
+	}
+	select {
+	case factura := <-recibidos:
+		assert.Equal(t, "A000000123", factura)
+	default:
+		t.Error("Mensaje no entregado")
+	}
+	assert.Empty(t, recibidos)
+}
+
+func TestDeadLetter(t *testing.T) {
+	creaTabla(t)
+	intentos := 0
+	outbox.RegisterHandler("falla", func(mensaje []byte) error {
+		intentos++
+		panic("error de entrega")
+	})
+	cfg := outbox.Config{MaxIntentos: 1}
+	outbox.Enqueue(nil, "falla", "mensaje")
+	for outbox.Dispatch(cfg, nil) > 0 {
+	}
+	assert.Equal(t, 1, intentos)
+	for outbox.Dispatch(cfg, nil) > 0 {
+	}
+	assert.Equal(t, 1, intentos)
+}
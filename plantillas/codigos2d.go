@@ -0,0 +1,164 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/boombuler/barcode/aztec"
+	"github.com/boombuler/barcode/datamatrix"
+	"github.com/boombuler/barcode/pdf417"
+)
+
+// Códigos 2D PDF417, DataMatrix y Aztec. Las impresoras EPSON los imprimen con GS ( k, el resto como imagen raster:
+//   - {2d-modulo 3}: módulo en puntos (1-16, PDF417 hasta 8)
+//   - {pdf417-ecc 2}: nivel de corrección de errores PDF417 (0-8)
+//   - {aztec-ecc 23}: porcentaje de corrección de errores Aztec (5-95)
+//   - {pdf417 texto}, {datamatrix texto}, {aztec texto}
+
+var re2DEscPos = regexp.MustCompile(`{2d-modulo ([0-9]+)}|{pdf417-ecc ([0-8])}|{aztec-ecc ([0-9]+)}|{(pdf417|datamatrix|aztec) ([^{}]+)}`)
+
+// Valores por defecto de los códigos 2D
+const (
+	modulo2D  = 3
+	eccPdf417 = 1
+	eccAztec  = 23
+)
+
+// Número de función GS ( k de cada símbolo (cn)
+var cn2D = map[string]byte{"pdf417": 48, "aztec": 53, "datamatrix": 54}
+
+// Tipo de código 2D de un número de función GS ( k, vacío si no es PDF417, Aztec o DataMatrix
+func tipo2D(cn byte) string {
+	for tipo, n := range cn2D {
+		if n == cn {
+			return tipo
+		}
+	}
+	return ""
+}
+
+// Procesa los códigos 2D, nativos o como imagen raster ajustada a un ancho imprimible de puntos
+func processEscPos2D(escpos []byte, perfil EscPosProfile, puntos int) []byte {
+	modulo := modulo2D
+	ecc := map[string]int{"pdf417": eccPdf417, "aztec": eccAztec}
+	return re2DEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
+		m := re2DEscPos.FindSubmatch(match)
+		switch {
+		case m[1] != nil:
+			n, _ := strconv.Atoi(string(m[1]))
+			if n < 1 || n > 16 {
+				return match
+			}
+			modulo = n
+			return nil
+		case m[2] != nil:
+			ecc["pdf417"], _ = strconv.Atoi(string(m[2]))
+			return nil
+		case m[3] != nil:
+			n, _ := strconv.Atoi(string(m[3]))
+			if n < 5 || n > 95 {
+				return match
+			}
+			ecc["aztec"] = n
+			return nil
+		}
+		tipo := string(m[4])
+		datos := m[5]
+		if slices.Contains(perfil.Codigos2D, tipo) {
+			return epson2D(tipo, datos, modulo, ecc[tipo])
+		}
+		if perfil.Raster == "" {
+			return match
+		}
+		// Reducimos el módulo hasta que quepa en el papel
+		for mod := modulo; mod >= 1; mod-- {
+			img, err := imagen2D(tipo, string(datos), mod, ecc[tipo])
+			if err != nil {
+				return match
+			}
+			if puntos == 0 || img.Rect.Dx() <= puntos {
+				raster, width, height := rasterGray(img)
+				return ordenRaster(perfil.Raster, raster, width, height)
+			}
+		}
+		return match
+	})
+}
+
+// Órdenes GS ( k de un código 2D EPSON: parámetros, almacenamiento e impresión
+func epson2D(tipo string, codigo []byte, modulo, ecc int) []byte {
+	cn := cn2D[tipo]
+	var datos []byte
+	switch tipo {
+	case "pdf417":
+		datos = []byte{GS, '(', 'k', 3, 0, cn, 65, 0}                                   // columnas automáticas
+		datos = append(datos, GS, '(', 'k', 3, 0, cn, 66, 0)                            // filas automáticas
+		datos = append(datos, GS, '(', 'k', 3, 0, cn, 67, byte(min(max(modulo, 2), 8))) // ancho del módulo
+		datos = append(datos, GS, '(', 'k', 3, 0, cn, 68, 3)                            // alto de fila
+		datos = append(datos, GS, '(', 'k', 4, 0, cn, 69, '0', byte('0'+ecc))           // nivel de corrección
+	case "datamatrix":
+		datos = []byte{GS, '(', 'k', 5, 0, cn, 66, 48, 0, 0} // cuadrado, tamaño automático
+		datos = append(datos, GS, '(', 'k', 3, 0, cn, 67, byte(min(max(modulo, 2), 16)))
+	case "aztec":
+		datos = []byte{GS, '(', 'k', 4, 0, cn, 66, 0, 0} // símbolo completo, capas automáticas
+		datos = append(datos, GS, '(', 'k', 3, 0, cn, 67, byte(min(max(modulo, 2), 16)))
+		datos = append(datos, GS, '(', 'k', 3, 0, cn, 69, byte(ecc))
+	}
+	p := len(codigo) + 3
+	datos = append(datos, GS, '(', 'k', byte(p), byte(p>>8), cn, 80, '0') // GS ( k pL pH cn 80 0
+	datos = append(datos, codigo...)
+	datos = append(datos, GS, '(', 'k', 3, 0, cn, 81, '0') // GS ( k 3 0 cn 81 0
+	return datos
+}
+
+// Genera la imagen de un código 2D, con un módulo en puntos. Las filas PDF417 tienen un alto de 3 módulos.
+func imagen2D(tipo, codigo string, modulo, ecc int) (*image.Gray, error) {
+	var img image.Image
+	var err error
+	mx, my := modulo, modulo
+	switch tipo {
+	case "pdf417":
+		img, err = pdf417.Encode(codigo, byte(ecc))
+		my = modulo * 3 / 2 // La imagen tiene 2 puntos por fila
+		if my == 0 {
+			my = 1
+		}
+	case "datamatrix":
+		img, err = datamatrix.Encode(codigo)
+	case "aztec":
+		img, err = aztec.Encode([]byte(codigo), ecc, 0)
+	default:
+		err = fmt.Errorf("código 2D %q desconocido", tipo)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, r.Dx()*mx, r.Dy()*my))
+	for y := 0; y < gray.Rect.Dy(); y++ {
+		for x := 0; x < gray.Rect.Dx(); x++ {
+			c := color.GrayModel.Convert(img.At(r.Min.X+x/mx, r.Min.Y+y/my)).(color.Gray)
+			gray.SetGray(x, y, c)
+		}
+	}
+	return gray, nil
+}
+
+// Convierte una imagen en blanco y negro a datos raster
+func rasterGray(img *image.Gray) (data []byte, width, height int) {
+	width, height = img.Rect.Dx(), img.Rect.Dy()
+	data = make([]byte, ((width+7)>>3)*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if img.GrayAt(x, y).Y < 128 {
+				puntoNegro(data, width, x, y)
+			}
+		}
+	}
+	return
+}
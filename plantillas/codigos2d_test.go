@@ -0,0 +1,53 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodigos2DEpson(t *testing.T) {
+	bin, _, err := plantillas.GenerateEscPos("{2d-modulo 4}{pdf417-ecc 3}{pdf417 ABC}{datamatrix 123}{aztec-ecc 30}{aztec XYZ}", plantillas.EPSON)
+	assert.NoError(t, err)
+	// PDF417: módulo, nivel de corrección, almacenamiento e impresión
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 3, 0, 48, 67, 4}))
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 4, 0, 48, 69, '0', '3'}))
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 6, 0, 48, 80, '0', 'A', 'B', 'C', plantillas.GS, '(', 'k', 3, 0, 48, 81, '0'}))
+	// DataMatrix
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 3, 0, 54, 67, 4}))
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 6, 0, 54, 80, '0', '1', '2', '3'}))
+	// Aztec
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 3, 0, 53, 69, 30}))
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.GS, '(', 'k', 3, 0, 53, 81, '0'}))
+	assert.NotContains(t, string(bin), "{")
+}
+
+func TestCodigos2DRaster(t *testing.T) {
+	// SEIKO y STAR no los soportan: se imprimen como imagen
+	bin, _, err := plantillas.GenerateEscPos("{datamatrix 123}", plantillas.SEIKO)
+	assert.NoError(t, err)
+	k := bytes.Index(bin, []byte{plantillas.ESC, 'b'})
+	if assert.True(t, k >= 0) {
+		// DataMatrix 10x10 con módulo 3: 30 puntos, 4 bytes por línea
+		assert.Equal(t, []byte{4, 30, 0}, bin[k+2:k+5])
+	}
+	bin, _, err = plantillas.GenerateEscPos("{aztec XYZ}", plantillas.STAR)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Contains(bin, []byte{plantillas.ESC, plantillas.GS, 'S', 1}))
+	// Se reduce el módulo para que quepa en el papel
+	bin, _, err = plantillas.GenerateEscPos("{paper-width 58}{2d-modulo 16}{pdf417 https://devel.horus.es}", plantillas.SEIKO)
+	assert.NoError(t, err)
+	k = bytes.Index(bin, []byte{plantillas.ESC, 'b'})
+	if assert.True(t, k >= 0) {
+		assert.LessOrEqual(t, int(bin[k+2]), 384/8)
+	}
+	// Sin imágenes ni soporte nativo se dejan sin procesar
+	perfil, err := plantillas.GetEscPosProfile("seiko")
+	assert.NoError(t, err)
+	perfil.Raster = ""
+	bin, _, err = plantillas.GenerateEscPosProfile("{aztec XYZ}", perfil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "{aztec XYZ}")
+}
@@ -0,0 +1,174 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/horus-es/go-util/v3/errores"
+)
+
+// Funciones de maquetación en columnas de las plantillas esc/pos. Los anchos se miden en caracteres
+// (un carácter acentuado ocupa uno, igual que en la impresora) según el papel y el estilo:
+//   - CPL "w": caracteres por línea con el estilo indicado (w doble ancho, s pequeño)
+//   - COLS "w:l* r10" a b: línea con columnas, ver columnasEscPos
+//   - WRAP texto [ancho]: divide un texto en líneas, por defecto del ancho del papel
+
+var reEspecColumna = regexp.MustCompile(`^([lrc])([0-9]*)(\*?)$`)
+
+// Caracteres por línea en un papel de mm con un estilo: 12 puntos por carácter (9 con s), el doble con w
+func cplEscPos(papel int, estilo string) int {
+	errores.PanicIfTrue(!reEstilosEscPos.MatchString("{"+estilo+"}"), "estilo %q no válido", estilo)
+	puntos := 12
+	if strings.Contains(estilo, "s") {
+		puntos = 9
+	}
+	if strings.Contains(estilo, "w") {
+		puntos *= 2
+	}
+	return puntosPapel(papel) / puntos
+}
+
+// Ancho del papel indicado en una plantilla con {paper-width}, por defecto 80mm
+func papelPlantilla(escpos string) int {
+	papel := 0
+	for _, m := range rePaperWidthEscPos.FindAllStringSubmatch(escpos, -1) {
+		w, _ := strconv.Atoi(m[1])
+		papel = max(papel, w)
+	}
+	if papel == 0 {
+		papel = 80
+	}
+	return papel
+}
+
+// Maqueta valores en columnas separadas por un espacio, según una especificación "[estilo:]col col...":
+//   - estilo: letras de estilo que afectan al ancho (w, s), opcional
+//   - col: alineación l/r/c seguida del ancho en caracteres (p.e. r10) o de * para repartir el resto de la línea
+//     proporcionalmente (p.e. l* o l2*)
+//
+// Los valores que no caben se dividen en varias líneas, alineadas en su columna.
+func columnasEscPos(papel int, spec string, valores ...any) string {
+	estilo, cols, ok := strings.Cut(spec, ":")
+	if !ok {
+		estilo, cols = "", spec
+	}
+	return columnasTexto(cplEscPos(papel, estilo), spec, cols, valores...)
+}
+
+// Maqueta valores en columnas en líneas de cpl caracteres, ver columnasEscPos
+func columnasTexto(cpl int, spec, cols string, valores ...any) string {
+	specs := strings.Fields(cols)
+	errores.PanicIfTrue(len(specs) == 0, "COLS %q sin columnas", spec)
+	errores.PanicIfTrue(len(specs) != len(valores), "COLS %q: %d columnas y %d valores", spec, len(specs), len(valores))
+	alineaciones := make([]byte, len(specs))
+	anchos := make([]int, len(specs))
+	pesos := make([]int, len(specs))
+	libre := cpl - len(specs) + 1
+	totalPesos := 0
+	for k, s := range specs {
+		m := reEspecColumna.FindStringSubmatch(s)
+		errores.PanicIfTrue(m == nil || (m[2] == "" && m[3] == ""), "COLS %q: columna %q no válida", spec, s)
+		alineaciones[k] = m[1][0]
+		n, _ := strconv.Atoi(m[2])
+		if m[3] == "" {
+			anchos[k] = n
+			libre -= n
+		} else {
+			pesos[k] = max(n, 1)
+			totalPesos += pesos[k]
+		}
+	}
+	errores.PanicIfTrue(libre < 0, "COLS %q: no caben las columnas en %d caracteres", spec, cpl)
+	// Repartimos el espacio libre entre las columnas proporcionales, el resto a la primera
+	resto := libre
+	primera := -1
+	for k, p := range pesos {
+		if p > 0 {
+			anchos[k] = libre * p / max(totalPesos, 1)
+			resto -= anchos[k]
+			if primera < 0 {
+				primera = k
+			}
+		}
+	}
+	if primera >= 0 {
+		anchos[primera] += resto
+	}
+	celdas := make([][]string, len(specs))
+	lineas := 0
+	for k, v := range valores {
+		errores.PanicIfTrue(anchos[k] < 1, "COLS %q: no caben las columnas en %d caracteres", spec, cpl)
+		celdas[k] = wrapTexto(fmt.Sprint(v), anchos[k])
+		lineas = max(lineas, len(celdas[k]))
+	}
+	var result strings.Builder
+	for n := range lineas {
+		var linea strings.Builder
+		for k := range celdas {
+			if k > 0 {
+				linea.WriteByte(' ')
+			}
+			texto := ""
+			if n < len(celdas[k]) {
+				texto = celdas[k][n]
+			}
+			linea.WriteString(alineaTexto(texto, anchos[k], alineaciones[k]))
+		}
+		if n > 0 {
+			result.WriteByte('\n')
+		}
+		result.WriteString(strings.TrimRight(linea.String(), " "))
+	}
+	return result.String()
+}
+
+// Alinea un texto a la izquierda (l), derecha (r) o centro (c) en un ancho de caracteres
+func alineaTexto(texto string, ancho int, alineacion byte) string {
+	relleno := ancho - utf8.RuneCountInString(texto)
+	if relleno <= 0 {
+		return texto
+	}
+	switch alineacion {
+	case 'r':
+		return strings.Repeat(" ", relleno) + texto
+	case 'c':
+		return strings.Repeat(" ", relleno/2) + texto + strings.Repeat(" ", relleno-relleno/2)
+	}
+	return texto + strings.Repeat(" ", relleno)
+}
+
+// Divide un texto en líneas de un ancho máximo de caracteres, por palabras. Las palabras más largas se cortan.
+// Se respetan los saltos de línea del texto.
+func wrapTexto(texto string, ancho int) []string {
+	var lineas []string
+	for _, parrafo := range strings.Split(texto, "\n") {
+		linea := ""
+		for _, palabra := range strings.Fields(parrafo) {
+			for utf8.RuneCountInString(palabra) > ancho {
+				if linea != "" {
+					lineas = append(lineas, linea)
+					linea = ""
+				}
+				runas := []rune(palabra)
+				lineas = append(lineas, string(runas[:ancho]))
+				palabra = string(runas[ancho:])
+			}
+			switch {
+			case palabra == "":
+			case linea == "":
+				linea = palabra
+			case utf8.RuneCountInString(linea)+1+utf8.RuneCountInString(palabra) <= ancho:
+				linea += " " + palabra
+			default:
+				lineas = append(lineas, linea)
+				linea = palabra
+			}
+		}
+		lineas = append(lineas, linea)
+	}
+	return lineas
+}
@@ -0,0 +1,46 @@
+package plantillas_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleMergeEscPosTemplate_columnas() {
+	plantilla := `{paper-width 58}{{range .Lines}}{{COLS "l* r8" .Service (PRICE .Price)}}
+{{end}}{w}{{COLS "w:l* r7" "Total" (PRICE 8.96)}}{}`
+	f, err := plantillas.MergeEscPosTemplate("columnas", plantilla, factura, "", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	fmt.Println(f)
+	// Output:
+	// {paper-width 58}Estancia 23/08/2022       3,00 €
+	// 12:43 (37 min)
+	// Lavado integral           5,96 €
+	// vehiculo
+	// {w}Total     8,96 €{}
+}
+
+func TestColumnas(t *testing.T) {
+	merge := func(plantilla string) string {
+		f, err := plantillas.MergeEscPosTemplate("columnas", plantilla, map[string]any{}, "", formato.DMA, formato.EUR)
+		assert.NoError(t, err)
+		return f
+	}
+	assert.Equal(t, "48 24 64 32", merge(`{{CPL}} {{CPL "w"}} {{CPL "s"}} {{CPL "ws"}}`))
+	assert.Equal(t, "{paper-width 58}32 16", merge(`{paper-width 58}{{CPL}} {{CPL "bw"}}`))
+	// Acentos: un carácter por letra
+	assert.Equal(t, "{paper-width 58}Añadido"+strings.Repeat(" ", 23)+"10", merge(`{paper-width 58}{{COLS "l* r2" "Añadido" 10}}`))
+	assert.Equal(t, "  ab     cd", merge(`{{COLS "c6 r4" "ab" "cd"}}`))
+	assert.Equal(t, "uno dos\ntres", merge(`{{WRAP "uno dos tres" 7}}`))
+	assert.Equal(t, "abcde\nfgh\nxy", merge(`{{WRAP "abcdefgh\nxy" 5}}`))
+	// Errores
+	for _, p := range []string{`{{COLS "l* x3" "a" "b"}}`, `{{COLS "l*" "a" "b"}}`, `{{COLS "l40 r40" "a" "b"}}`, `{{CPL "z"}}`} {
+		_, err := plantillas.MergeEscPosTemplate("columnas", p, map[string]any{}, "", formato.DMA, formato.EUR)
+		assert.Error(t, err, p)
+	}
+}
@@ -0,0 +1,708 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"bytes"
+	"image"
+	"strings"
+
+	"github.com/horus-es/go-util/v3/barcode"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Decodificación de un flujo esc/pos binario en una secuencia de elementos (texto con estilos, saltos,
+// imágenes, códigos...), común a las vistas previas HTML, PDF, PNG y SVG.
+
+// Tipo de un elemento esc/pos decodificado
+type EscPosElementType int
+
+// Tipos de elementos
+const (
+	EscPosText      EscPosElementType = iota // Texto con estilo
+	EscPosLineFeed                           // Salto de línea
+	EscPosImage                              // Imagen raster, también códigos 2D y gráficos NV
+	EscPosBarcode                            // Código de barras
+	EscPosQR                                 // Código QR
+	EscPosCut                                // Corte de papel o fin de etiqueta
+	EscPosPageStart                          // Inicio de un área en modo página
+	EscPosPosition                           // Bloque en una posición absoluta del modo página
+	EscPosPageEnd                            // Fin del modo página
+	EscPosDrawer                             // Apertura del cajón portamonedas
+	EscPosBeep                               // Aviso sonoro
+	EscPosLayout                             // Cambio de interlineado, margen izquierdo o ancho de impresión
+)
+
+// Nombres de los tipos de elementos
+var nombresElementos = [...]string{"text", "line-feed", "image", "barcode", "qr", "cut", "page-start", "position", "page-end", "drawer", "beep", "layout"}
+
+// Nombre del tipo de elemento
+func (t EscPosElementType) String() string {
+	if t < 0 || int(t) >= len(nombresElementos) {
+		return "unknown"
+	}
+	return nombresElementos[t]
+}
+
+// Estilo del texto
+type EscPosStyle struct {
+	Alineacion string // left, center o right
+	Negrita    bool
+	Subrayado  bool
+	Pequeno    bool
+	DobleAncho bool
+	DobleAlto  bool
+	Inverso    bool // Blanco sobre negro
+	Invertido  bool // Arriba-abajo
+	FuenteC    bool // Fuente C, con Pequeno
+	Espaciado  int  // Espacio a la derecha de cada carácter en puntos (ESC SP)
+}
+
+// Elemento de un flujo esc/pos decodificado. Según el tipo se usan unos campos u otros:
+//   - EscPosText: Estilo y Texto
+//   - EscPosImage: Imagen y la alineación de Estilo
+//   - EscPosBarcode: Simbologia, Texto (el código), Modulo, Altura, HRI y la alineación de Estilo
+//   - EscPosQR: Datos, Modulo, ECC y la alineación de Estilo
+//   - EscPosPageStart: área de impresión X, Y, Ancho y Alto, y Direccion
+//   - EscPosPosition: posición X, Y
+//   - EscPosDrawer: Cajon
+//   - EscPosBeep: Pitidos y Duracion, o Duracion 0 para el zumbador sin duración propia
+//   - EscPosLayout: Interlineado, margen izquierdo X y ancho de impresión Ancho, 0 si son los de por defecto
+type EscPosElement struct {
+	Tipo         EscPosElementType
+	Estilo       EscPosStyle  // Estilo de textos, alineación de imágenes y códigos
+	Texto        string       // Texto o código de barras
+	Imagen       *image.Gray  // Imagen, un pixel por punto
+	Datos        []byte       // Datos del código QR
+	Simbologia   barcode.KIND // Tipo de código de barras
+	Modulo       int          // Módulo en puntos del código de barras o QR
+	Altura       int          // Altura en puntos del código de barras
+	ECC          int          // Corrección de errores del QR (0-3)
+	HRI          barcode.HRI  // Texto del código de barras
+	X, Y         int          // Posición en puntos (modo página)
+	Ancho        int          // Ancho del área en puntos (modo página)
+	Alto         int          // Alto del área en puntos (modo página)
+	Direccion    byte         // Dirección ESC T (modo página): 0 normal, 1 90º antihorario, 2 180º, 3 90º horario
+	Cajon        int          // Cajón portamonedas: 1 o 2
+	Pitidos      int          // Número de pitidos
+	Duracion     int          // Duración de cada pitido en décimas de segundo
+	Interlineado int          // Interlineado en puntos
+}
+
+// Decodifica un flujo esc/pos EPSON, SEIKO o STAR (binario) en una lista de elementos, p.e. para inspeccionar
+// un fichero .prn capturado. Las secuencias desconocidas se ignoran.
+func ParseEscPos(escpos []byte) []EscPosElement {
+	var elementos []EscPosElement
+
+	// Estado inicial
+	estilo := EscPosStyle{Alineacion: "left"}
+	bcHeight := 162
+	bcWidth := 3
+	bcHRI := barcode.None
+	qrModulo := 3
+	qrECC := 48
+	var qrData []byte
+	nvImages := map[string]*image.Gray{}
+	modulos2D := map[string]int{"pdf417": modulo2D, "datamatrix": modulo2D, "aztec": modulo2D}
+	ecc2D := map[string]int{"pdf417": eccPdf417, "aztec": eccAztec}
+	datos2D := map[string][]byte{}
+	pagina := charmap.Windows1252
+	star := false // Órdenes Star Line Mode, se detectan por las secuencias ESC GS
+
+	// Modo página: área, dirección ESC T y posición en puntos
+	enPagina := false
+	paginaAbierta := false
+	bloqueAbierto := false
+	areaX, areaY, areaW, areaH := 0, 0, 576, 400
+	direccion := byte(0)
+	posX, posY := 0, 0
+
+	// Interlineado, margen izquierdo y ancho de impresión en puntos, 0 por defecto
+	var maquetacion EscPosElement
+
+	textBuffer := strings.Builder{}
+	estiloBuffer := estilo
+	col := 0
+
+	// Agrega un elemento. En modo página se abre antes el área y un bloque en la posición actual.
+	emite := func(e EscPosElement) {
+		if enPagina && !bloqueAbierto && e.Tipo != EscPosCut {
+			if !paginaAbierta {
+				paginaAbierta = true
+				elementos = append(elementos, EscPosElement{Tipo: EscPosPageStart, X: areaX, Y: areaY, Ancho: areaW, Alto: areaH, Direccion: direccion})
+			}
+			bloqueAbierto = true
+			elementos = append(elementos, EscPosElement{Tipo: EscPosPosition, X: posX, Y: posY})
+		}
+		elementos = append(elementos, e)
+	}
+
+	// Vacía el buffer de texto
+	flushBuffer := func() {
+		if textBuffer.Len() == 0 {
+			return
+		}
+		emite(EscPosElement{Tipo: EscPosText, Estilo: estiloBuffer, Texto: textBuffer.String()})
+		textBuffer.Reset()
+	}
+
+	// Agrega una imagen con la alineación actual
+	emiteImagen := func(img *image.Gray) {
+		flushBuffer()
+		emite(EscPosElement{Tipo: EscPosImage, Estilo: EscPosStyle{Alineacion: estilo.Alineacion}, Imagen: img})
+	}
+
+	// Agrega un código QR con la alineación actual
+	emiteQR := func(datos []byte, modulo, ecc int) {
+		if ecc >= 48 {
+			ecc -= 48
+		}
+		flushBuffer()
+		emite(EscPosElement{Tipo: EscPosQR, Estilo: EscPosStyle{Alineacion: estilo.Alineacion}, Datos: datos, Modulo: modulo, ECC: ecc})
+	}
+
+	// Agrega un código de barras con la alineación actual
+	emiteBC := func(codigo string, kind byte, modulo, altura int, hri barcode.HRI) {
+		flushBuffer()
+		emite(EscPosElement{Tipo: EscPosBarcode, Estilo: EscPosStyle{Alineacion: estilo.Alineacion}, Texto: codigo, Simbologia: tipoBC(kind), Modulo: modulo, Altura: altura, HRI: hri})
+	}
+
+	// Agrega un corte
+	corte := func() {
+		flushBuffer()
+		elementos = append(elementos, EscPosElement{Tipo: EscPosCut})
+	}
+
+	// Agrega la apertura del cajón o un aviso sonoro, fuera de los bloques del modo página
+	periferico := func(e EscPosElement) {
+		flushBuffer()
+		elementos = append(elementos, e)
+	}
+
+	// Cambia el interlineado, el margen o el ancho de impresión
+	maqueta := func(interlineado, margen, ancho int) {
+		nueva := EscPosElement{Tipo: EscPosLayout, Interlineado: interlineado, X: margen, Ancho: ancho}
+		if nueva.Interlineado == maquetacion.Interlineado && nueva.X == maquetacion.X && nueva.Ancho == maquetacion.Ancho {
+			return
+		}
+		flushBuffer()
+		maquetacion = nueva
+		elementos = append(elementos, nueva)
+	}
+
+	// Cierra el bloque en curso del modo página
+	cierraBloque := func() {
+		flushBuffer()
+		bloqueAbierto = false
+	}
+
+	// Cierra la página en curso y vuelve al modo estándar
+	cierraPagina := func() {
+		cierraBloque()
+		if paginaAbierta {
+			paginaAbierta = false
+			elementos = append(elementos, EscPosElement{Tipo: EscPosPageEnd})
+		}
+		enPagina = false
+		direccion = 0
+		posX, posY = 0, 0
+	}
+
+	// Cambia la alineación según el parámetro de ESC a
+	alinea := func(n byte) {
+		flushBuffer()
+		switch n {
+		case 0, '0':
+			estilo.Alineacion = "left"
+		case 1, '1':
+			estilo.Alineacion = "center"
+		case 2, '2':
+			estilo.Alineacion = "right"
+		}
+	}
+
+	for i := 0; i < len(escpos); i++ {
+		switch escpos[i] {
+		case LF: // Nueva línea
+			flushBuffer()
+			emite(EscPosElement{Tipo: EscPosLineFeed})
+			col = 0
+			posX = 0
+			if maquetacion.Interlineado > 0 {
+				posY += maquetacion.Interlineado
+			} else {
+				posY += interlineadoPagina
+			}
+
+		case CR: // Retorno de carro
+			// ignoramos
+
+		case FF: // Fin de etiqueta
+			if enPagina {
+				// Fin de página
+				cierraPagina()
+				break
+			}
+			corte()
+
+		case BEL: // Zumbador, cajón 1 en STAR
+			if star {
+				periferico(EscPosElement{Tipo: EscPosDrawer, Cajon: 1})
+			} else {
+				periferico(EscPosElement{Tipo: EscPosBeep, Pitidos: 1})
+			}
+
+		case SUB: // Cajón 2 STAR
+			if star {
+				periferico(EscPosElement{Tipo: EscPosDrawer, Cajon: 2})
+			}
+
+		case SI, DC2: // Arriba/abajo STAR
+			if star {
+				flushBuffer()
+				estilo.Invertido = escpos[i] == SI
+			}
+
+		case TAB: // Tabulaciones (convertir en espacios cada 8 posiciones)
+			for col%8 != 0 {
+				textBuffer.WriteByte(' ')
+				col++
+			}
+
+		case ESC:
+			if i+1 < len(escpos) {
+				var next byte
+				if i+2 < len(escpos) {
+					next = escpos[i+2]
+				}
+				switch escpos[i+1] {
+				case '@': // ESC @ (reset)
+					cierraPagina()
+					estilo = EscPosStyle{Alineacion: "left"}
+					bcHeight = 162
+					bcWidth = 3
+					bcHRI = barcode.None
+					qrModulo = 3
+					qrECC = 48
+					qrData = nil
+					pagina = charmap.Windows1252
+					estiloBuffer = estilo
+					col = 0
+					maqueta(0, 0, 0)
+					i += 1
+				case '!': // ESC ! (tamaño de fuente, negrita, subrrayado)
+					flushBuffer()
+					estilo.Pequeno = (next & 0x01) > 0
+					estilo.FuenteC = false
+					estilo.Negrita = (next & 0x08) > 0
+					estilo.DobleAlto = (next & 0x10) > 0
+					estilo.DobleAncho = (next & 0x20) > 0
+					estilo.Subrayado = (next & 0x80) > 0
+					i += 2
+				case 'M': // ESC M n (fuente A, B o C)
+					if star {
+						// ESC M (paso de 12 puntos STAR)
+						i++
+						break
+					}
+					flushBuffer()
+					estilo.Pequeno = next&3 != 0
+					estilo.FuenteC = next&3 == 2
+					i += 2
+				case ' ': // ESC SP n (espaciado entre caracteres)
+					flushBuffer()
+					estilo.Espaciado = int(next)
+					i += 2
+				case '3': // ESC 3 n (interlineado)
+					maqueta(int(next), maquetacion.X, maquetacion.Ancho)
+					i += 2
+				case '2': // ESC 2 (interlineado por defecto)
+					maqueta(0, maquetacion.X, maquetacion.Ancho)
+					i++
+				case '-': // ESC - (subrayado)
+					flushBuffer()
+					estilo.Subrayado = next == 1 || next == 2 || next == '1' || next == '2'
+					i += 2
+				case '{': // ESC { (arriba/abajo)
+					flushBuffer()
+					estilo.Invertido = next%2 == 1
+					i += 2
+				case 'E': // ESC E (negrita)
+					flushBuffer()
+					if star {
+						estilo.Negrita = true
+						i += 1
+					} else {
+						estilo.Negrita = next%2 == 1
+						i += 2
+					}
+				case 'F': // ESC F (fin de negrita STAR)
+					flushBuffer()
+					estilo.Negrita = false
+					i += 1
+				case '4', '5': // ESC 4 / ESC 5 (blanco sobre negro STAR)
+					flushBuffer()
+					estilo.Inverso = escpos[i+1] == '4'
+					i += 1
+				case RS: // ESC RS F n (fuente STAR)
+					if next == 'F' && i+3 < len(escpos) {
+						flushBuffer()
+						estilo.Pequeno = escpos[i+3]%2 == 1
+						i += 3
+					}
+				case 'a': // ESC a (alineación)
+					alinea(next)
+					i += 2
+				case 'd': // ESC d (n saltos de línea)
+					flushBuffer()
+					if star {
+						// ESC d n (corte STAR)
+						corte()
+						i += 2
+						break
+					}
+					for next > 0 {
+						emite(EscPosElement{Tipo: EscPosLineFeed})
+						next--
+					}
+					col = 0
+					i += 2
+				case 'i', 'm': // ESC i (corte total) / ESC m (corte parcial)
+					flushBuffer()
+					if star && escpos[i+1] == 'i' {
+						// ESC i n1 n2 (ampliación STAR)
+						if i+3 < len(escpos) {
+							estilo.DobleAlto = next > 0
+							estilo.DobleAncho = escpos[i+3] > 0
+						}
+						i += 3
+						break
+					}
+					corte()
+					i++
+					if next == LF {
+						// El salto de línea tras el corte no se imprime
+						i++
+					}
+				case 'p': // ESC p m t1 t2 (pulso del cajón)
+					periferico(EscPosElement{Tipo: EscPosDrawer, Cajon: int(next&1) + 1})
+					i += 4
+				case '(': // ESC ( A pL pH fn a n t (pitidos EPSON)
+					if next != 'A' || i+4 >= len(escpos) {
+						break
+					}
+					z := int(escpos[i+3]) + int(escpos[i+4])*256
+					if z == 4 && i+8 < len(escpos) && escpos[i+5] == 48 {
+						periferico(EscPosElement{Tipo: EscPosBeep, Pitidos: int(escpos[i+7]), Duracion: int(escpos[i+8])})
+					}
+					i += 4 + z
+				case 'L': // ESC L (modo página)
+					flushBuffer()
+					enPagina = true
+					posX, posY = 0, 0
+					i += 1
+				case 'W': // ESC W xL xH yL yH dxL dxH dyL dyH (área de impresión)
+					if i+9 < len(escpos) {
+						p := escpos[i+2 : i+10]
+						areaX = int(p[0]) + int(p[1])*256
+						areaY = int(p[2]) + int(p[3])*256
+						areaW = int(p[4]) + int(p[5])*256
+						areaH = int(p[6]) + int(p[7])*256
+					}
+					i += 9
+				case 'T': // ESC T n (dirección en modo página)
+					if enPagina && !paginaAbierta {
+						direccion = next % 4
+					}
+					i += 2
+				case '$': // ESC $ nL nH (posición horizontal absoluta)
+					if i+3 < len(escpos) {
+						cierraBloque()
+						posX = int(next) + int(escpos[i+3])*256
+					}
+					i += 3
+				case 't': // ESC t (página de código) 16=WIN1252
+					if cm := charmapEscT(next, false); cm != nil {
+						pagina = cm
+					}
+					i += 2
+				case GS: // ESC GS (STAR)
+					star = true
+					if i+3 >= len(escpos) {
+						break
+					}
+					switch next {
+					case 'a': // ESC GS a n (alineación)
+						alinea(escpos[i+3])
+						i += 3
+					case 't': // ESC GS t n (página de código) 32=WIN1252
+						if cm := charmapEscT(escpos[i+3], true); cm != nil {
+							pagina = cm
+						}
+						i += 3
+					case BEL: // ESC GS BEL m t1 t2 (zumbador externo)
+						periferico(EscPosElement{Tipo: EscPosBeep, Pitidos: 1})
+						i += 5
+					case 'y': // ESC GS y (QR)
+						switch escpos[i+3] {
+						case 'S': // ESC GS y S n1 n2 (parámetros)
+							if i+5 < len(escpos) {
+								switch escpos[i+4] {
+								case 1, '1':
+									qrECC = int(escpos[i+5])
+								case 2, '2':
+									qrModulo = int(escpos[i+5])
+								}
+							}
+							i += 5
+						case 'D': // ESC GS y D 1 m nL nH ... (datos)
+							if i+7 < len(escpos) {
+								z := int(escpos[i+6]) + int(escpos[i+7])*256
+								if i+8+z <= len(escpos) {
+									qrData = escpos[i+8 : i+8+z]
+								}
+								i += 7 + z
+							}
+						case 'P': // ESC GS y P (imprimir)
+							emiteQR(qrData, qrModulo, qrECC)
+							i += 3
+						}
+					case 'S': // ESC GS S m xL xH yL yH n ... (raster STAR)
+						if i+8 < len(escpos) {
+							w := (int(escpos[i+4]) + int(escpos[i+5])*256) * 8
+							h := int(escpos[i+6]) + int(escpos[i+7])*256
+							z := w * h / 8
+							if i+9+z <= len(escpos) {
+								emiteImagen(decodeRastrerImage(&escpos, i+9, z, w, h))
+								i += 8 + z
+							}
+						}
+					}
+				case 'q': // ESC q S E V M n1 n2 ... (QR SEIKO)
+					if i+8 < len(escpos) {
+						qrModulo := int(escpos[i+2])
+						qrECC := int(escpos[i+3])
+						z := int(escpos[i+6]) + int(escpos[i+7])*256
+						i += 8
+						if i+z <= len(escpos) {
+							emiteQR(escpos[i:i+z], qrModulo, qrECC)
+							i += z - 1
+						}
+					}
+				case 'b': // ESC b n1 n2 n3 ... ESC J 0 (raster SEIKO)
+					if star {
+						// ESC b n1 n2 n3 n4 ... RS (código de barras STAR)
+						z := bytes.IndexByte(escpos[min(i+6, len(escpos)):], RS)
+						if z > 0 {
+							codigo := string(escpos[i+6 : i+6+z])
+							hri := barcode.None
+							if escpos[i+3] == 2 || escpos[i+3] == 4 || escpos[i+3] == '2' || escpos[i+3] == '4' {
+								hri = barcode.Below
+							}
+							kinds := map[byte]byte{'0': 66, '1': 65, '2': 68, '3': 67, '4': 69, '5': 70, '6': 0xff, '7': 72, '8': 71}
+							emiteBC(codigo, kinds[escpos[i+2]|'0'], int(escpos[i+4]%16)+1, int(escpos[i+5]), hri)
+							i += 6 + z
+						}
+						break
+					}
+					if i+5 < len(escpos) {
+						w := int(escpos[i+2]) * 8
+						h := int(escpos[i+3]) + int(escpos[i+4])*256
+						z := w * h / 8
+						i += 5
+						if i+z+3 < len(escpos) && escpos[i+z] == ESC && escpos[i+z+1] == 'J' {
+							emiteImagen(decodeRastrerImage(&escpos, i, z, w, h))
+							i += z + 3
+						}
+					}
+				}
+			}
+
+		case GS:
+			if i+1 < len(escpos) {
+				var next byte
+				if i+2 < len(escpos) {
+					next = escpos[i+2]
+				}
+				switch escpos[i+1] {
+				case 'B': // GS B (blanco sobre negro)
+					flushBuffer()
+					estilo.Inverso = next%2 == 1
+					i += 2
+				case 'L': // GS L nL nH (margen izquierdo)
+					if i+3 < len(escpos) {
+						maqueta(maquetacion.Interlineado, int(next)+int(escpos[i+3])*256, maquetacion.Ancho)
+					}
+					i += 3
+				case 'W': // GS W nL nH (ancho de impresión)
+					if i+3 < len(escpos) {
+						maqueta(maquetacion.Interlineado, maquetacion.X, int(next)+int(escpos[i+3])*256)
+					}
+					i += 3
+				case '$': // GS $ nL nH (posición vertical absoluta en modo página)
+					if i+3 < len(escpos) {
+						cierraBloque()
+						posY = int(next) + int(escpos[i+3])*256
+					}
+					i += 3
+				case 'v':
+					// GS v 0 0 xL xH yL yH (raster EPSON)
+					if next == '0' && i+8 < len(escpos) {
+						w := (int(escpos[i+4]) + int(escpos[i+5])*256) * 8
+						h := int(escpos[i+6]) + int(escpos[i+7])*256
+						z := w * h / 8
+						i += 8
+						if i+z < len(escpos) {
+							emiteImagen(decodeRastrerImage(&escpos, i, z, w, h))
+							i += z
+						}
+					}
+				case '(':
+					// GS (k (QR EPSON)
+					if next == 'k' && i+4 < len(escpos) {
+						z := int(escpos[i+3]) + int(escpos[i+4])*256
+						i += 4
+						if i+z >= len(escpos) {
+							// Datos incompletos: fin de la decodificación
+							i = len(escpos)
+							break
+						}
+						// QR
+						if z == 3 && escpos[i+1] == '1' && escpos[i+2] == 67 {
+							qrModulo = int(escpos[i+3])
+						}
+						if z == 3 && escpos[i+1] == '1' && escpos[i+2] == 69 {
+							qrECC = int(escpos[i+3])
+						}
+						if z > 3 && escpos[i+1] == '1' && escpos[i+2] == 80 && escpos[i+3] == '0' {
+							qrData = escpos[i+4 : i+z+1]
+						}
+						if z == 3 && escpos[i+1] == '1' && escpos[i+2] == 81 && escpos[i+3] == '0' {
+							emiteQR(qrData, qrModulo, qrECC)
+						}
+						// PDF417, Aztec y DataMatrix
+						if z >= 3 && tipo2D(escpos[i+1]) != "" {
+							tipo := tipo2D(escpos[i+1])
+							switch escpos[i+2] {
+							case 67:
+								modulos2D[tipo] = int(escpos[i+3])
+							case 69:
+								if tipo == "pdf417" && z == 4 {
+									ecc2D[tipo] = int(escpos[i+4]) - '0'
+								} else {
+									ecc2D[tipo] = int(escpos[i+3])
+								}
+							case 80:
+								datos2D[tipo] = escpos[i+4 : i+z+1]
+							case 81:
+								img, err := imagen2D(tipo, string(datos2D[tipo]), modulos2D[tipo], ecc2D[tipo])
+								if err == nil {
+									emiteImagen(img)
+								}
+							}
+						}
+						i += z
+					}
+					// GS ( L (gráficos NV EPSON)
+					if next == 'L' && i+4 < len(escpos) {
+						z := int(escpos[i+3]) + int(escpos[i+4])*256
+						i += 4
+						if z == 6 && i+z < len(escpos) && escpos[i+2] == 69 {
+							// Impresión: solo se muestra si la imagen se grabó en el mismo flujo
+							if nv, ok := nvImages[string(escpos[i+3:i+5])]; ok {
+								emiteImagen(nv)
+							} else {
+								flushBuffer()
+								emite(EscPosElement{Tipo: EscPosText, Estilo: EscPosStyle{Alineacion: estilo.Alineacion}, Texto: "[NV " + string(escpos[i+3:i+5]) + "]"})
+								emite(EscPosElement{Tipo: EscPosLineFeed})
+							}
+						}
+						if z > 11 && i+z < len(escpos) && escpos[i+2] == 67 {
+							if nv := decodeNvImage(escpos[i+1 : i+z+1]); nv != nil {
+								nvImages[string(escpos[i+4:i+6])] = nv
+							}
+						}
+						i += z
+					}
+				case '8':
+					// GS 8 L (gráficos NV EPSON de más de 64KB)
+					if next == 'L' && i+6 < len(escpos) {
+						z := int(escpos[i+3]) + int(escpos[i+4])<<8 + int(escpos[i+5])<<16 + int(escpos[i+6])<<24
+						i += 6
+						if z > 11 && i+z < len(escpos) && escpos[i+2] == 67 {
+							if nv := decodeNvImage(escpos[i+1 : i+z+1]); nv != nil {
+								nvImages[string(escpos[i+4:i+6])] = nv
+							}
+						}
+						i += z
+					}
+				case 'h': // GS h (barcode height)
+					bcHeight = int(next)
+					i += 2
+				case 'w': // GS w (barcode width)
+					bcWidth = int(next)
+					i += 2
+				case 'H': // GS H (barcode show)
+					switch next {
+					case 0, '0':
+						bcHRI = barcode.None
+					case 1, '1':
+						bcHRI = barcode.Above
+					case 2, '2':
+						bcHRI = barcode.Below
+					case 3, '3':
+						bcHRI = barcode.Both
+					}
+					i += 2
+				case 'k': // GS k (print barcode)
+					z := 0
+					if next <= 7 && i+2 < len(escpos) {
+						i += 2
+						for i+z+1 < len(escpos) && escpos[i+z+1] != 0 {
+							z++
+						}
+						if i+z+1 >= len(escpos) {
+							// Sin NUL final: fin de la decodificación
+							i = len(escpos)
+							break
+						}
+					}
+					if next >= 65 && next <= 79 && i+3 < len(escpos) {
+						i += 3
+						z = int(escpos[i])
+						if i+z >= len(escpos) {
+							// Datos incompletos: fin de la decodificación
+							i = len(escpos)
+							break
+						}
+					}
+					if z > 0 {
+						emiteBC(string(escpos[i+1:i+z+1]), next, bcWidth, bcHeight, bcHRI)
+						i += z
+						if next <= 7 {
+							i++ // NUL final
+						}
+					}
+				}
+			}
+
+		case FS:
+			if i+1 < len(escpos) {
+				switch escpos[i+1] {
+				case '.': // Cancel Kanji character mode
+					i++
+				}
+			}
+
+		default: // Texto normal
+			if estilo != estiloBuffer {
+				flushBuffer()
+				estiloBuffer = estilo
+			}
+			col++
+			textBuffer.WriteRune(pagina.DecodeByte(escpos[i]))
+		}
+	}
+
+	flushBuffer()
+	return elementos
+}
@@ -0,0 +1,103 @@
+package plantillas_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/barcode"
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEscPos(t *testing.T) {
+	for _, familia := range []int{plantillas.EPSON, plantillas.SEIKO, plantillas.STAR} {
+		prn, _, err := plantillas.GenerateEscPos("{cbw}Título{}\n{ou}Total{}\n{bc-height 60}{bc-hri below}{ean-13 123456789012}\n{qr-ecc H}{qr ABC}\n{full-cut}", familia)
+		errores.PanicIfError(err)
+		var tipos []plantillas.EscPosElementType
+		for _, e := range plantillas.ParseEscPos(prn) {
+			tipos = append(tipos, e.Tipo)
+			switch e.Tipo {
+			case plantillas.EscPosText:
+				if e.Texto == "Título" {
+					assert.Equal(t, plantillas.EscPosStyle{Alineacion: "center", Negrita: true, DobleAncho: true}, e.Estilo, familia)
+				} else {
+					assert.Equal(t, "Total", e.Texto, familia)
+					assert.True(t, e.Estilo.Inverso && e.Estilo.Subrayado, familia)
+				}
+			case plantillas.EscPosBarcode:
+				assert.Equal(t, barcode.EAN13, e.Simbologia, familia)
+				assert.Equal(t, "123456789012", e.Texto, familia)
+				assert.Equal(t, 60, e.Altura, familia)
+				assert.Equal(t, barcode.Below, e.HRI, familia)
+			case plantillas.EscPosQR:
+				assert.Equal(t, []byte("ABC"), e.Datos, familia)
+				assert.Equal(t, 3, e.ECC, familia)
+			}
+		}
+		assert.Equal(t, []plantillas.EscPosElementType{
+			plantillas.EscPosText, plantillas.EscPosLineFeed,
+			plantillas.EscPosText, plantillas.EscPosLineFeed,
+			plantillas.EscPosBarcode, plantillas.EscPosLineFeed,
+			plantillas.EscPosQR, plantillas.EscPosLineFeed,
+			plantillas.EscPosCut,
+		}, tipos, familia)
+	}
+}
+
+func TestParseEscPosPagina(t *testing.T) {
+	prn, _, err := plantillas.GenerateEscPos("{page 10 20 300 200}{page-dir 90}{pos 5 40}Hola{end-page}", plantillas.EPSON)
+	errores.PanicIfError(err)
+	elementos := plantillas.ParseEscPos(prn)
+	if !assert.Len(t, elementos, 4) {
+		return
+	}
+	assert.Equal(t, plantillas.EscPosElement{Tipo: plantillas.EscPosPageStart, X: 10, Y: 20, Ancho: 300, Alto: 200, Direccion: 3}, elementos[0])
+	assert.Equal(t, plantillas.EscPosElement{Tipo: plantillas.EscPosPosition, X: 5, Y: 40}, elementos[1])
+	assert.Equal(t, "Hola", elementos[2].Texto)
+	assert.Equal(t, plantillas.EscPosPageEnd, elementos[3].Tipo)
+}
+
+func ExampleParseEscPos() {
+	prn, _, err := plantillas.GenerateEscPos("{b}Total: 15,06 €{}\n{ean-13 123456789012}\n{full-cut}", plantillas.EPSON)
+	errores.PanicIfError(err)
+	for _, e := range plantillas.ParseEscPos(prn) {
+		switch e.Tipo {
+		case plantillas.EscPosText:
+			fmt.Printf("%s %q negrita=%v\n", e.Tipo, e.Texto, e.Estilo.Negrita)
+		case plantillas.EscPosBarcode:
+			fmt.Printf("%s %q\n", e.Tipo, e.Texto)
+		default:
+			fmt.Println(e.Tipo)
+		}
+	}
+	// Output:
+	// text "Total: 15,06 €" negrita=true
+	// line-feed
+	// barcode "123456789012"
+	// line-feed
+	// cut
+}
+
+func TestParseEscPosTruncado(t *testing.T) {
+	// Cualquier prefijo de un fichero .prn capturado se decodifica sin pánico
+	for _, fn := range []string{"epson_test_expect.prn", "seiko_test_expect.prn"} {
+		prn, err := os.ReadFile(fn)
+		errores.PanicIfError(err)
+		for n := range len(prn) + 1 {
+			assert.NotPanics(t, func() { plantillas.ParseEscPos(prn[:n]) }, "%s[:%d]", fn, n)
+		}
+	}
+	const GS = plantillas.GS
+	for _, prn := range [][]byte{
+		{GS, 'k', 4, 'A', 'B'},
+		{GS, 'k', 67, 12, '1'},
+		{GS, 'k'},
+		{GS, '(', 'k', 3, 0},
+		{GS, '(', 'k', 10, 0, '1'},
+		{GS, '(', 'k', 1, 0, '1'},
+	} {
+		assert.NotPanics(t, func() { plantillas.ParseEscPos(prn) }, "%v", prn)
+	}
+}
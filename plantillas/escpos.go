@@ -42,10 +42,55 @@ Códigos QR
   - {qr-modulo 3}: módulo del código QR (1-16)
   - {qr https://devel.horus.es}
 
+Modo página (solo EPSON), coordenadas en puntos:
+  - {page 576 400} o {page x y 576 400}: inicia el modo página con un área de impresión
+  - {page-dir 90}: dirección del texto, giro en sentido horario (0/90/180/270)
+  - {pos 100 40}: posición absoluta en la dirección actual
+  - {end-page}: imprime la página y vuelve al modo estándar
+
+Códigos 2D (nativos en EPSON, como imagen en el resto)
+  - {2d-modulo 3}: módulo de los códigos 2D (1-16)
+  - {pdf417-ecc 1}: nivel de corrección de errores PDF417 (0-8)
+  - {aztec-ecc 23}: porcentaje de corrección de errores Aztec (5-95)
+  - {pdf417 texto}, {datamatrix texto}, {aztec texto}
+
 Imágenes:
-  - {logo.png}: fichero en formato png
+  - {img logo.png}: fichero en formato png o jpeg, reducido si excede el ancho imprimible del papel
+  - {img foto.jpg mode=floyd width=300}: modo de conversión a blanco y negro (threshold/floyd/ordered) y ancho en puntos
+  - {nv-img LG}: imagen grabada previamente en la memoria NV de la impresora con UploadNVImage (solo EPSON)
+
+Espaciado, fuentes y márgenes (solo EPSON y SEIKO), en puntos:
+  - {line-spacing 40}: interlineado (0-255); {line-spacing} vuelve al interlineado por defecto
+  - {char-spacing 2}: espacio entre caracteres (0-255)
+  - {font a}, {font b} o {font c}: fuente de los caracteres, hasta el siguiente cambio de estilo
+  - {left-margin 40}: margen izquierdo
+  - {print-width 512}: ancho del área de impresión a partir del margen
+
+Cajón portamonedas y avisos sonoros (marcados en las vistas previas):
+  - {drawer 1}: abre el cajón conectado al pin 2 (1) o al pin 5 (2)
+  - {beep 3 2}: pitidos (1-63) y su duración en décimas de segundo (1-255), solo EPSON
+  - {buzzer}: aviso sonoro corto
+
+Se soportan las funciones de formato DATETIME, DATE, TIME y PRICE, y las de maquetación en columnas según el ancho
+del papel ({paper-width}, por defecto 80mm):
+  - {{CPL "w"}}: caracteres por línea con un estilo (w doble ancho, s pequeño), p.e. 48 en papel de 80mm
+  - {{COLS "l* r10" .Service (PRICE .Price)}}: columnas alineadas l/r/c de ancho fijo o proporcional (*), separadas por un espacio.
+    Los textos largos se dividen en varias líneas. Con estilo: {w}{{COLS "w:l* r8" .Name .Total}}{}
+  - {{WRAP .Description}} o {{WRAP .Description 20}}: divide un texto en líneas del ancho del papel o del indicado
+
+Las funciones VAT y VATINC agrupan las líneas por tipo impositivo y calculan bases, cuotas y totales, igual que en las
+plantillas XHTML: {{with VATINC .Lines "Price" "VatRate"}}{{range .Tipos}}{{COLS "l* r10" .Tipo (PRICE .Cuota)}}{{end}}{{end}}
 
-Se soportan las funciones de formato DATETIME, DATE, TIME y PRICE.
+La página de códigos por defecto es Windows-1252, se pueden usar otras con GenerateEscPosCodePage.
+Las capacidades de cada modelo de impresora (papel, códigos de barras, QR, imágenes, cortador...) se describen con perfiles, ver GenerateEscPosProfile.
+Se soportan las familias de impresoras EPSON, SEIKO y STAR (Star Line Mode).
+Los comandos desconocidos o no válidos se imprimen como texto; ValidateEscPos los detecta con su línea y columna,
+y en modo estricto (GenerateEscPosStrict o perfil.Estricto) se devuelven como error.
+Los tickets generados se convierten a PDF con GenerateEscPosPdf o WriteEscPosPdf, sin dependencias externas, y se
+puede obtener su vista previa como imagen con RenderEscPosImage, WriteEscPosPng o WriteEscPosSvg, o como HTML con
+WriteEscPosHTML y WriteEscPosHTMLFragment.
+Un binario esc/pos, p.e. un fichero .prn capturado, se puede decodificar en una lista de elementos con ParseEscPos.
+Los visores de cliente de 2 líneas de 20 caracteres tienen sus propias plantillas, ver MergeDisplayTemplate y GenerateDisplay.
 
 Ejemplo de plantillla en https://github.com/horus-es/go-util/blob/main/plantillas/plantilla.escpos
 */
@@ -54,6 +99,7 @@ package plantillas
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -67,6 +113,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"text/template"
@@ -77,8 +124,6 @@ import (
 	"github.com/horus-es/go-util/v3/errores"
 	"github.com/horus-es/go-util/v3/formato"
 	go_qr "github.com/piglig/go-qr"
-	"golang.org/x/text/encoding/charmap"
-	"golang.org/x/text/transform"
 )
 
 // Fusiona una plantilla esc/pos con un struct o map de datos.
@@ -89,7 +134,54 @@ import (
 //   - ff: formato de las fechas para las funciones DATETIME y DATE
 //   - fp: formato de los precios para la funcion PRICE
 func MergeEscPosTemplate(name, escpos string, datos any, assets string, ff formato.Fecha, fp formato.Moneda) (string, error) {
+	papel := papelPlantilla(escpos)
 	var funciones = template.FuncMap{
+		"PRICE": func(f float64) string {
+			return fmt.Sprintf("%10s", formato.PrintPrecio(f, fp, formato.DECIMALES_DEFECTO))
+		},
+		"CPL": func(estilo ...string) int {
+			return cplEscPos(papel, strings.Join(estilo, ""))
+		},
+		"COLS": func(spec string, valores ...any) string {
+			return columnasEscPos(papel, spec, valores...)
+		},
+		"WRAP": func(texto string, ancho ...int) string {
+			if len(ancho) == 0 {
+				ancho = []int{cplEscPos(papel, "")}
+			}
+			errores.PanicIfTrue(ancho[0] < 1, "WRAP: ancho %d no válido", ancho[0])
+			return strings.Join(wrapTexto(texto, ancho[0]), "\n")
+		},
+	}
+	for nombre, f := range funcionesFecha(ff) {
+		funciones[nombre] = f
+	}
+	for nombre, f := range funcionesImpuestos(fp) {
+		funciones[nombre] = f
+	}
+	var opt string
+	if reflect.TypeOf(datos).Kind() == reflect.Map {
+		// En los mapas se permite que falten campos
+		opt = "missingkey=zero"
+	} else {
+		// En las estructuras se exige la existencia del dato
+		opt = "missingkey=error"
+	}
+	tmpl, err := template.New(filepath.Join(assets, name)).Funcs(funciones).Option(opt).Parse(escpos)
+	if err != nil {
+		return "", err
+	}
+	var marshaled bytes.Buffer
+	err = tmpl.Execute(&marshaled, datos)
+	if err != nil {
+		return "", err
+	}
+	return marshaled.String(), nil
+}
+
+// Funciones de fecha comunes a las plantillas: DATETIME, DATE y TIME
+func funcionesFecha(ff formato.Fecha) map[string]any {
+	return map[string]any{
 		"DATETIME": func(x any) string {
 			switch t := x.(type) {
 			case time.Time:
@@ -129,32 +221,11 @@ func MergeEscPosTemplate(name, escpos string, datos any, assets string, ff forma
 			errores.PanicIfTrue(true, "fecha %q no soportada", x)
 			return ""
 		},
-		"PRICE": func(f float64) string {
-			return fmt.Sprintf("%10s", formato.PrintPrecio(f, fp, formato.DECIMALES_DEFECTO))
-		},
-	}
-	var opt string
-	if reflect.TypeOf(datos).Kind() == reflect.Map {
-		// En los mapas se permite que falten campos
-		opt = "missingkey=zero"
-	} else {
-		// En las estructuras se exige la existencia del dato
-		opt = "missingkey=error"
 	}
-	tmpl, err := template.New(filepath.Join(assets, name)).Funcs(funciones).Option(opt).Parse(escpos)
-	if err != nil {
-		return "", err
-	}
-	var marshaled bytes.Buffer
-	err = tmpl.Execute(&marshaled, datos)
-	if err != nil {
-		return "", err
-	}
-	return marshaled.String(), nil
 }
 
 // Expresiones regulares esc/pos
-var reEstilosEscPos = regexp.MustCompile(`{[whsbuioxlrc]*}`)
+var reEstilosEscPos = regexp.MustCompile(`{[whsbuoxlrc]*}`)
 var reResetEscPos = regexp.MustCompile(`{reset}`)
 var reFullCutEscPos = regexp.MustCompile(`{full-cut}`)
 var rePartialCutEscPos = regexp.MustCompile(`{partial-cut}`)
@@ -175,19 +246,71 @@ const (
 	LF    = byte(0x0a)
 	CR    = byte(0x0d)
 	FF    = byte(0x0c)
+	SI    = byte(0x0f)
+	DLE   = byte(0x10)
+	DC2   = byte(0x12)
 	ESC   = byte(0x1b)
 	FS    = byte(0x1c)
 	GS    = byte(0x1d)
-	EPSON = 1 // Familia de impresoras normalmente usadas en POS: Epson, Bixolon, Posiflex, Star, Citizen, Sunmi
+	RS    = byte(0x1e)
+	EPSON = 1 // Familia de impresoras normalmente usadas en POS: Epson, Bixolon, Posiflex, Star (modo esc/pos), Citizen, Sunmi
 	SEIKO = 2 // Familia de impresoras normalmente usadas en KIOSKOS: Nippon Primex, Seiko, Axiohm, Fujitsu
+	STAR  = 3 // Impresoras Star en modo Star Line Mode: TSP100, TSP650, TSP700, mC-Print
 )
 
-// Genera un []byte esc/pos (binario) a partir de una plantilla *.escpos.
-// Parámetro familia: EPSON/SEIKO
+// Genera un []byte esc/pos (binario) a partir de una plantilla *.escpos, con la página de códigos Windows-1252.
+// Parámetro familia: EPSON/SEIKO/STAR
 func GenerateEscPos(escpos string, familia int) (bin []byte, width int, err error) {
+	return GenerateEscPosProfile(escpos, perfilFamilia(familia))
+}
+
+// Genera un []byte esc/pos (binario) a partir de una plantilla *.escpos, con una página de códigos.
+// Los caracteres que no existen en la página se transliteran (p.e. ő => o) o se sustituyen por '?'.
+// Parámetro familia: EPSON/SEIKO/STAR
+func GenerateEscPosCodePage(escpos string, familia int, cp CodePage) (bin []byte, width int, err error) {
+	perfil := perfilFamilia(familia)
+	perfil.CodePage = cp
+	return GenerateEscPosProfile(escpos, perfil)
+}
+
+// Genera un []byte esc/pos (binario) a partir de una plantilla *.escpos en modo estricto, con la página de códigos
+// Windows-1252: si la plantilla tiene comandos desconocidos o no válidos devuelve un EscPosValidationError.
+// Parámetro familia: EPSON/SEIKO/STAR
+func GenerateEscPosStrict(escpos string, familia int) (bin []byte, width int, err error) {
+	perfil := perfilFamilia(familia)
+	perfil.Estricto = true
+	return GenerateEscPosProfile(escpos, perfil)
+}
+
+// Genera un []byte esc/pos (binario) a partir de una plantilla *.escpos, según las capacidades de una impresora (ver GetEscPosProfile).
+// Los comandos que la impresora no soporta se dejan sin procesar, salvo en modo estricto (perfil.Estricto), en el que
+// se devuelve un EscPosValidationError con todos los problemas de la plantilla.
+func GenerateEscPosProfile(escpos string, perfil EscPosProfile) (bin []byte, width int, err error) {
+
+	// Validamos la plantilla en modo estricto
+	if perfil.Estricto {
+		if problemas := ValidateEscPos(escpos, perfil); len(problemas) > 0 {
+			return nil, 0, EscPosValidationError(problemas)
+		}
+	}
+
+	// Seleccionamos la página de códigos
+	if len(perfil.CodePages) > 0 && !slices.Contains(perfil.CodePages, perfil.CodePage) {
+		return nil, 0, fmt.Errorf("página de códigos %d no soportada por la impresora %s", perfil.CodePage, perfil.Nombre)
+	}
+	n, err := escT(perfil.CodePage, perfil.Familia)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	// Convertimos a windows-1252
-	bin = win1252(escpos, familia)
+	// Convertimos a la página de códigos
+	bin = codificaTexto(escpos, perfil.CodePage)
+	switch perfil.Familia {
+	case EPSON, SEIKO:
+		bin = append([]byte{ESC, '@', FS, '.', ESC, 't', n}, bin...)
+	case STAR:
+		bin = append([]byte{ESC, '@', ESC, GS, 't', n}, bin...)
+	}
 
 	// Quitamos espacios iniciales y finales
 	bin = bytes.TrimSpace(bin)
@@ -196,61 +319,82 @@ func GenerateEscPos(escpos string, familia int) (bin []byte, width int, err erro
 	bin = bytes.ReplaceAll(bin, []byte{'\r'}, nil)
 
 	// Procesamos estilos
-	bin = processEscPosStyles(bin)
+	bin = processEscPosStyles(bin, perfil.Familia)
 
 	// Procesamos códigos de control
-	bin, width = processEscPosControls(bin, familia)
+	bin, width = processEscPosControls(bin, perfil, n)
+
+	// Procesamos el cajón y el zumbador
+	bin = processEscPosPerifericos(bin, perfil)
 
-	switch familia {
+	switch perfil.Familia {
 	case EPSON:
+		// Procesamos espaciado, fuentes y márgenes
+		bin = processEscPosEspaciado(bin)
+		// Procesamos el modo página
+		if perfil.ModoPagina {
+			bin = processEpsonPage(bin)
+		}
 		// Procesamos códigos de barras
-		bin = processEpsonBarcodes(bin)
+		bin = processEpsonBarcodes(bin, perfil)
 		// Procesamos códigos QR
-		bin = processEpsonQR(bin)
-		// Procesamos imágenes
-		bin = processEpsonImg(bin)
+		if perfil.QR {
+			bin = processEpsonQR(bin, perfil)
+		}
 	case SEIKO:
+		// Procesamos espaciado, fuentes y márgenes
+		bin = processEscPosEspaciado(bin)
+		// Procesamos códigos de barras
+		bin = processSeikoBarcodes(bin, perfil)
+		// Procesamos códigos QR
+		if perfil.QR {
+			bin = processSeikoQR(bin, perfil)
+		}
+	case STAR:
 		// Procesamos códigos de barras
-		bin = processSeikoBarcodes(bin)
+		bin = processStarBarcodes(bin, perfil)
 		// Procesamos códigos QR
-		bin = processSeikoQR(bin)
-		// Procesamos imágenes
-		bin = processSeikoImg(bin)
+		if perfil.QR {
+			bin = processStarQR(bin, perfil)
+		}
 	}
-	return
-}
 
-func win1252(escpos string, familia int) (bin []byte) {
-	var buf bytes.Buffer
-	writer := transform.NewWriter(&buf, charmap.Windows1252.NewEncoder())
-	_, err := writer.Write([]byte(escpos))
-	errores.PanicIfError(err)
-	err = writer.Close()
-	errores.PanicIfError(err)
-	switch familia {
-	case EPSON:
-		bin = append([]byte{ESC, '@', FS, '.', ESC, 't', 16}, buf.Bytes()...)
-	case SEIKO:
-		bin = append([]byte{ESC, '@', FS, '.', ESC, 't', 5}, buf.Bytes()...)
-	default:
-		bin = buf.Bytes()
+	// Procesamos códigos 2D e imágenes, ajustándolos al ancho imprimible
+	puntos := puntosPapel(width)
+	if width == perfil.AnchoPapel && perfil.AnchoPuntos > 0 {
+		puntos = perfil.AnchoPuntos
+	}
+	bin = processEscPos2D(bin, perfil, puntos)
+	switch perfil.Raster {
+	case RASTER_GS_V:
+		bin = processEpsonImg(bin, puntos)
+	case RASTER_ESC_B:
+		bin = processSeikoImg(bin, puntos)
+	case RASTER_ESC_GS_S:
+		bin = processStarImg(bin, puntos)
+	}
+
+	// Procesamos gráficos NV
+	if perfil.GraficosNV {
+		bin = processEpsonNvImg(bin)
 	}
 	return
 }
 
+// Estado de los estilos de la impresora
+type tEstadoEstilos struct {
+	alignment    byte
+	isBold       bool
+	isUnderline  bool
+	isSmall      bool
+	isDoubleX    bool
+	isDoubleY    bool
+	isReverse    bool
+	isUpsideDown bool
+}
+
 // Procesa los estilos esc/pos
-func processEscPosStyles(escpos []byte) []byte {
-	// Estado de los estimos de la impresora
-	type tEstadoEstilos struct {
-		alignment    byte
-		isBold       bool
-		isUnderline  bool
-		isSmall      bool
-		isDoubleX    bool
-		isDoubleY    bool
-		isReverse    bool
-		isUpsideDown bool
-	}
+func processEscPosStyles(escpos []byte, familia int) []byte {
 	estado := tEstadoEstilos{alignment: 'l'}
 	var result bytes.Buffer
 	posiciones := reEstilosEscPos.FindAllIndex(escpos, -1)
@@ -284,6 +428,11 @@ func processEscPosStyles(escpos []byte) []byte {
 				errores.PanicIfTrue(true, "estilo %c no soportado", letra)
 			}
 		}
+		if familia == STAR {
+			estilosStar(&result, estado, nuevo)
+			estado = nuevo
+			continue
+		}
 		if estado.alignment != nuevo.alignment { // debe ser lo primero de la línea!
 			// ESC a
 			result.WriteByte(ESC)
@@ -346,20 +495,29 @@ func processEscPosStyles(escpos []byte) []byte {
 }
 
 // Procesa las secuencias de control esc/pos y extrae el ancho del papel
-func processEscPosControls(escpos []byte, familia int) ([]byte, int) {
+func processEscPosControls(escpos []byte, perfil EscPosProfile, escT byte) ([]byte, int) {
 	var width int
 	var result []byte
-	switch familia {
-	case EPSON:
-		result = reResetEscPos.ReplaceAll(escpos, []byte{ESC, '@', FS, '.', ESC, 't', 16}) // ESC @ FS . ESC t 16
-	case SEIKO:
-		result = reResetEscPos.ReplaceAll(escpos, []byte{ESC, '@', FS, '.', ESC, 't', 5}) // ESC @ FS . ESC t 5
+	switch perfil.Familia {
+	case EPSON, SEIKO:
+		result = reResetEscPos.ReplaceAll(escpos, []byte{ESC, '@', FS, '.', ESC, 't', escT}) // ESC @ FS . ESC t n
+	case STAR:
+		result = reResetEscPos.ReplaceAll(escpos, []byte{ESC, '@', ESC, GS, 't', escT}) // ESC @ ESC GS t n
 	default:
 		result = escpos
 	}
-	result = reFullCutEscPos.ReplaceAll(result, []byte{ESC, 'i'})    // ESC i
-	result = rePartialCutEscPos.ReplaceAll(result, []byte{ESC, 'm'}) // ESC m
-	result = reFormFeedEscPos.ReplaceAll(result, []byte{FF})         // FF
+	switch {
+	case !perfil.Cortador:
+		result = reFullCutEscPos.ReplaceAll(result, nil)
+		result = rePartialCutEscPos.ReplaceAll(result, nil)
+	case perfil.Familia == STAR:
+		result = reFullCutEscPos.ReplaceAll(result, []byte{ESC, 'd', '0'})    // ESC d 0
+		result = rePartialCutEscPos.ReplaceAll(result, []byte{ESC, 'd', '1'}) // ESC d 1
+	default:
+		result = reFullCutEscPos.ReplaceAll(result, []byte{ESC, 'i'})    // ESC i
+		result = rePartialCutEscPos.ReplaceAll(result, []byte{ESC, 'm'}) // ESC m
+	}
+	result = reFormFeedEscPos.ReplaceAll(result, []byte{FF}) // FF
 	result = rePaperWidthEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
 		submatches := rePaperWidthEscPos.FindSubmatch(match)
 		w, _ := strconv.Atoi(string(submatches[1]))
@@ -367,13 +525,13 @@ func processEscPosControls(escpos []byte, familia int) ([]byte, int) {
 		return nil
 	})
 	if width == 0 {
-		width = 80 // Por defecto 80mm
+		width = perfil.AnchoPapel // Por defecto el del perfil
 	}
 	return result, width
 }
 
 // Procesa los códigos de barras EPSON
-func processEpsonBarcodes(escpos []byte) []byte {
+func processEpsonBarcodes(escpos []byte, perfil EscPosProfile) []byte {
 	result := reBcHeightEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
 		submatches := reBcHeightEscPos.FindSubmatch(match)
 		h := bytesToByte(submatches[1])
@@ -385,7 +543,7 @@ func processEpsonBarcodes(escpos []byte) []byte {
 	result = reBcModuloEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
 		submatches := reBcModuloEscPos.FindSubmatch(match)
 		m := bytesToByte(submatches[1])
-		if m >= 2 && m <= 6 {
+		if int(m) >= perfil.BcModuloMin && int(m) <= perfil.BcModuloMax {
 			return []byte{GS, 'w', m} // GS w modulo
 		}
 		return match
@@ -410,10 +568,10 @@ func processEpsonBarcodes(escpos []byte) []byte {
 		tipo := string(submatches[1])
 		codigo := submatches[2]
 		var l byte
-		if len(codigo) < 30 { // Suficiente
+		if len(codigo) <= perfil.BcLongitud {
 			l = byte(len(codigo))
 		}
-		if l == 0 {
+		if l == 0 || !perfil.soportaBarcode(tipo) {
 			return match
 		}
 		switch tipo {
@@ -480,7 +638,7 @@ func processEpsonBarcodes(escpos []byte) []byte {
 }
 
 // Procesa los códigos de barras SEIKO
-func processSeikoBarcodes(escpos []byte) []byte {
+func processSeikoBarcodes(escpos []byte, perfil EscPosProfile) []byte {
 	result := reBcHeightEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
 		submatches := reBcHeightEscPos.FindSubmatch(match)
 		h := bytesToByte(submatches[1])
@@ -492,7 +650,7 @@ func processSeikoBarcodes(escpos []byte) []byte {
 	result = reBcModuloEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
 		submatches := reBcModuloEscPos.FindSubmatch(match)
 		m := bytesToByte(submatches[1])
-		if m >= 2 && m <= 4 {
+		if int(m) >= perfil.BcModuloMin && int(m) <= perfil.BcModuloMax {
 			return []byte{GS, 'w', m} // GS w modulo
 		}
 		return match
@@ -517,10 +675,10 @@ func processSeikoBarcodes(escpos []byte) []byte {
 		tipo := string(submatches[1])
 		codigo := submatches[2]
 		var l byte
-		if len(codigo) < 30 { // Suficiente
+		if len(codigo) <= perfil.BcLongitud {
 			l = byte(len(codigo))
 		}
-		if l == 0 {
+		if l == 0 || !perfil.soportaBarcode(tipo) {
 			return match
 		}
 		switch tipo {
@@ -594,11 +752,11 @@ func processSeikoBarcodes(escpos []byte) []byte {
 }
 
 // Procesa los códigos QR EPSON
-func processEpsonQR(escpos []byte) []byte {
+func processEpsonQR(escpos []byte, perfil EscPosProfile) []byte {
 	result := reQrModuloEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
 		submatches := reQrModuloEscPos.FindSubmatch(match)
 		m := bytesToByte(submatches[1])
-		if m >= 1 && m <= 16 {
+		if m >= 1 && int(m) <= perfil.QrModuloMax {
 			return []byte{GS, '(', 'k', 3, 0, '1', 67, m} // GS ( k ... 1 67 modulo
 		}
 		return match
@@ -637,14 +795,14 @@ func processEpsonQR(escpos []byte) []byte {
 }
 
 // Procesa los códigos QR SEIKO
-func processSeikoQR(escpos []byte) []byte {
+func processSeikoQR(escpos []byte, perfil EscPosProfile) []byte {
 	var modulo byte = 4
 	var ecc byte = 0
 	result := reQrAnyEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
 		submatches := reQrAnyEscPos.FindSubmatch(match)
 		if bytes.HasPrefix(match, []byte("{qr-modulo ")) {
 			m := bytesToByte(submatches[1])
-			if m < 1 || m > 20 {
+			if m < 1 || int(m) > perfil.QrModuloMax {
 				return match
 			}
 			modulo = m
@@ -678,40 +836,21 @@ func processSeikoQR(escpos []byte) []byte {
 	return result
 }
 
-func processEpsonImg(escpos []byte) []byte {
-	result := reImgEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
-		submatches := reImgEscPos.FindSubmatch(match)
-		raster, width, height, err := rasterize(string(submatches[1]))
-		if err == nil {
-			var datos []byte
-			ancho := (width + 7) >> 3
-			xL := byte(ancho)
-			xH := byte(ancho >> 8)
-			yL := byte(height)
-			yH := byte(height >> 8)
-			datos = []byte{GS, 'v', '0', 0, xL, xH, yL, yH} // GS v 0 0 xL xH yL yH
-			datos = append(datos, raster...)                // raster
-			return datos
-		}
-		return match
-	})
-	return result
+func processEpsonImg(escpos []byte, puntos int) []byte {
+	return processImg(escpos, RASTER_GS_V, puntos)
+}
+
+func processSeikoImg(escpos []byte, puntos int) []byte {
+	return processImg(escpos, RASTER_ESC_B, puntos)
 }
 
-func processSeikoImg(escpos []byte) []byte {
+// Procesa los comandos {img} con una orden raster
+func processImg(escpos []byte, orden string, puntos int) []byte {
 	result := reImgEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
 		submatches := reImgEscPos.FindSubmatch(match)
-		raster, width, height, err := rasterize(string(submatches[1]))
+		raster, width, height, err := rasterizeImg(string(submatches[1]), puntos)
 		if err == nil {
-			var datos []byte
-			ancho := (width + 7) >> 3
-			x := byte(ancho)
-			yL := byte(height)
-			yH := byte(height >> 8)
-			datos = []byte{ESC, 'b', x, yL, yH} // ESC b n1 n2 n3
-			datos = append(datos, raster...)    // raster
-			datos = append(datos, ESC, 'J', 0)  // ESC J 0
-			return datos
+			return ordenRaster(orden, raster, width, height)
 		}
 		return match
 	})
@@ -803,12 +942,13 @@ func rasterize(file string) (data []byte, width, height int, err error) {
 	return
 }
 
-// Genera un fichero PDF a partir de una secuencia esc/pos. Parámetros:
+// Genera un fichero PDF a partir de una secuencia esc/pos a través de la vista previa HTML,
+// usando la utilidad wkhtmltopdf, que debe estar previamente instalada. Parámetros:
 //   - escpos: secuencia binaria esc/pos, tal y como se enviaría a la impresora
 //   - out: fichero PDF de salida
 //   - width: ancho del papel en mm
 //   - opciones: opciones adicionales utilidad wkhtmltopdf (ver https://wkhtmltopdf.org/usage/wkhtmltopdf.txt)
-func GenerateEscPosPdf(escpos []byte, out string, width int, opciones ...string) error {
+func GenerateEscPosPdfWkhtml(escpos []byte, out string, width int, opciones ...string) error {
 	// Fichero temporal
 	tmp, err := os.CreateTemp("", "horus-*.html")
 	if err != nil {
@@ -817,21 +957,11 @@ func GenerateEscPosPdf(escpos []byte, out string, width int, opciones ...string)
 	defer os.Remove(tmp.Name())
 
 	// Documento html
-	tmp.WriteString("<!DOCTYPE html>\n")
-	tmp.WriteString("<html>\n")
-	tmp.WriteString("<head>\n")
-	tmp.WriteString("<title>Recibo</title>\n")
-	tmp.WriteString("<meta http-equiv=\"Content-Type\" content=\"text/html; charset=Windows-1252\" />\n")
-	tmp.WriteString("<style>\n")
-	// Añadimos CSS para tickets
-	addEscPosCSS(tmp, width)
-	tmp.WriteString("</style>\n")
-	tmp.WriteString("</head>\n")
-	tmp.WriteString("<body>\n")
-	// Añadimos HTML ticket
-	addEscPosHTML(tmp, escpos)
-	tmp.WriteString("</body>\n")
-	tmp.WriteString("</html>\n")
+	err = WriteEscPosHTML(tmp, width, escpos)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
 	err = tmp.Close()
 	if err != nil {
 		return err
@@ -839,11 +969,16 @@ func GenerateEscPosPdf(escpos []byte, out string, width int, opciones ...string)
 	// Ejecución wkhtmltopdf
 	args := append([]string{"-q", "--enable-local-file-access", "--no-outline"}, opciones...)
 	args = append(args, tmp.Name(), out)
-	cmd := exec.Command("wkhtmltopdf", args...)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second) // timeout de 1 minuto, de momento hardcodeado
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "wkhtmltopdf", args...)
 	var log bytes.Buffer
 	cmd.Stdout = &log
 	cmd.Stderr = &log
 	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timeout")
+	}
 	if err != nil {
 		s := "wkhtmltopdf " + strings.Join(args, " ") + "\n" + err.Error() + "\n" + log.String()
 		s = strings.TrimSpace(s)
@@ -854,6 +989,53 @@ func GenerateEscPosPdf(escpos []byte, out string, width int, opciones ...string)
 	return nil
 }
 
+// Escribe un documento HTML completo y autocontenido con la vista previa de uno o varios tickets esc/pos (binario),
+// uno al lado del otro. Las imágenes y los códigos se incluyen en el propio documento. Parámetro width: ancho del papel en mm,
+// 80 si es 0.
+func WriteEscPosHTML(w io.Writer, width int, tickets ...[]byte) error {
+	if width <= 0 {
+		width = 80
+	}
+	var html bytes.Buffer
+	html.WriteString("<!DOCTYPE html>\n")
+	html.WriteString("<html>\n")
+	html.WriteString("<head>\n")
+	html.WriteString("<title>Recibo</title>\n")
+	html.WriteString("<meta http-equiv=\"Content-Type\" content=\"text/html; charset=UTF-8\" />\n")
+	html.WriteString("<style>\n")
+	// Añadimos CSS para tickets
+	addEscPosCSS(&html, width)
+	html.WriteString("</style>\n")
+	html.WriteString("</head>\n")
+	html.WriteString("<body>\n")
+	// Añadimos HTML tickets
+	for _, escpos := range tickets {
+		addEscPosHTML(&html, escpos)
+	}
+	html.WriteString("</body>\n")
+	html.WriteString("</html>\n")
+	_, err := w.Write(html.Bytes())
+	return err
+}
+
+// Escribe un fragmento HTML con la vista previa de uno o varios tickets esc/pos (binario), para incluirlo en otra página:
+// un elemento <style> con el CSS de los tickets seguido de un elemento <escpos> por etiqueta. Parámetro width: ancho del papel
+// en mm, 80 si es 0.
+func WriteEscPosHTMLFragment(w io.Writer, width int, tickets ...[]byte) error {
+	if width <= 0 {
+		width = 80
+	}
+	var html bytes.Buffer
+	html.WriteString("<style>\n")
+	addEscPosCSS(&html, width)
+	html.WriteString("</style>\n")
+	for _, escpos := range tickets {
+		addEscPosHTML(&html, escpos)
+	}
+	_, err := w.Write(html.Bytes())
+	return err
+}
+
 // Añade el CSS necesario para esc/pos
 func addEscPosCSS(html io.Writer, width int) {
 	io.WriteString(html, "escpos { font-family: 'DejaVu Sans Mono', monospace; font-size: 12px; white-space: pre-wrap; display: inline-block; border: 1px solid black; padding: 1em; margin: 1em; word-break: break-all; vertical-align: top; width: "+strconv.Itoa(width)+"mm; }\n")
@@ -870,324 +1052,185 @@ func addEscPosCSS(html io.Writer, width int) {
 	io.WriteString(html, "escpos .small { font-size: 0.75em; }\n")
 	io.WriteString(html, "escpos .small.doubleX { font-size: 1.5em; }\n")
 	io.WriteString(html, "escpos .small.double { font-size: 1.5em; }\n")
+	io.WriteString(html, "escpos .small.fontc { font-size: 0.67em; }\n")
+	io.WriteString(html, "escpos .small.fontc.doubleX, escpos .small.fontc.double { font-size: 1.33em; }\n")
 	io.WriteString(html, "escpos .reverse { background-color: black; color: white; }\n")
 	io.WriteString(html, "escpos .upsidedown { display: inline-block; scale: -1 -1; }\n")
+	io.WriteString(html, "escpos .marker { display: block; width: fit-content; margin: 0 auto; font-size: 0.75em; background-color: black; color: white; }\n")
+	io.WriteString(html, "escpos .page { display: block; position: relative; overflow: hidden; outline: 1px dashed #999; }\n")
+	io.WriteString(html, "escpos .page > div { position: absolute; left: 0; top: 0; transform-origin: 0 0; }\n")
+	io.WriteString(html, "escpos .page .block { position: absolute; white-space: pre; line-height: 15px; }\n")
 }
 
-// Añade el HTML de las etiquetas esc/pos
+// Añade el HTML de las etiquetas esc/pos. Las medidas en puntos se dividen entre 2, igual que las imágenes.
 func addEscPosHTML(html io.Writer, escpos []byte) {
-	// Estado inicial
-	alignment := "left"
-	isBold := false
-	isUnderline := false
-	isSmall := false
-	isDoubleX := false
-	isDoubleY := false
-	isReverse := false
-	isUpsideDown := false
 	inLabel := false
-	bcHeight := 162
-	bcWidth := 3
-	bcHRI := barcode.None
-	qrModulo := 3
-	qrECC := 48
-	var qrData []byte
-	var img *image.Gray
-
-	textBuffer := strings.Builder{}
-	currentClass := alignment
-	col := 0
+	cortada := false // Etiqueta terminada con un corte, se cierra al empezar la siguiente
+	bloqueAbierto := false
+	enPagina := false
+	maquetacion := "" // Estilo del interlineado, margen y ancho de impresión en curso
+	maquetaAbierta := ""
 
-	writeToHtml := func(s string) {
-		if len(s) == 0 {
+	// Abre el div del interlineado, margen y ancho de impresión en curso, cerrando el anterior
+	aplicaMaqueta := func() {
+		if maquetaAbierta == maquetacion {
 			return
 		}
-		if !inLabel {
-			inLabel = true
-			io.WriteString(html, "<escpos>")
+		if maquetaAbierta != "" {
+			io.WriteString(html, "</div>")
 		}
-		io.WriteString(html, s)
+		if maquetacion != "" {
+			io.WriteString(html, `<div class="layout" style="`+maquetacion+`">`)
+		}
+		maquetaAbierta = maquetacion
 	}
 
-	// Vacía el buffer y lo agrega a la salida
-	flushBuffer := func() {
-		if textBuffer.Len() == 0 {
-			return
+	// Cierra la etiqueta en curso
+	cierraLabel := func() {
+		if maquetaAbierta != "" {
+			io.WriteString(html, "</div>")
+			maquetaAbierta = ""
 		}
-		writeToHtml(fmt.Sprintf("<span class=\"%s\">%s</span>", currentClass, textBuffer.String()))
-		textBuffer.Reset()
+		inLabel = false
+		io.WriteString(html, "</escpos>\n")
 	}
 
-	// Obtiene la clase actual para textos
-	getTextClass := func() string {
-		class := []string{alignment}
-		if isBold {
-			class = append(class, "bold")
-		}
-		if isUnderline {
-			class = append(class, "underline")
-		}
-		if isDoubleX && !isDoubleY {
-			class = append(class, "doubleX")
-		}
-		if !isDoubleX && isDoubleY {
-			class = append(class, "doubleY")
-		}
-		if isDoubleY && isDoubleX {
-			class = append(class, "double")
+	writeToHtml := func(s string) {
+		if len(s) == 0 {
+			return
 		}
-		if isSmall {
-			class = append(class, "small")
+		if cortada {
+			cortada = false
+			cierraLabel()
 		}
-		if isReverse {
-			class = append(class, "reverse")
+		if !inLabel {
+			inLabel = true
+			io.WriteString(html, "<escpos>")
 		}
-		if isUpsideDown {
-			class = append(class, "upsidedown")
+		if !enPagina {
+			aplicaMaqueta()
 		}
-		return strings.Join(class, " ")
+		io.WriteString(html, s)
 	}
 
-	for i := 0; i < len(escpos); i++ {
-		switch escpos[i] {
-		case LF: // Nueva línea
-			flushBuffer()
-			writeToHtml("\n")
-			col = 0
-
-		case CR: // Retorno de carro
-			// ignoramos
-
-		case FF: // Fin de etiqueta
-			flushBuffer()
-			if inLabel {
-				inLabel = false
-				io.WriteString(html, "</escpos>\n")
-			}
-
-		case TAB: // Tabulaciones (convertir en espacios cada 8 posiciones)
-			for col%8 != 0 {
-				textBuffer.WriteByte(' ')
-				col++
-			}
-
-		case ESC:
-			if i+1 < len(escpos) {
-				var next byte
-				if i+2 < len(escpos) {
-					next = escpos[i+2]
-				}
-				switch escpos[i+1] {
-				case '@': // ESC @ (reset)
-					flushBuffer()
-					isBold = false
-					isUnderline = false
-					isSmall = false
-					isReverse = false
-					isUpsideDown = false
-					isDoubleX = false
-					isDoubleY = false
-					alignment = "left"
-					bcHeight = 162
-					bcWidth = 3
-					bcHRI = barcode.None
-					qrModulo = 3
-					qrECC = 48
-					qrData = nil
-					img = nil
-					currentClass = alignment
-					col = 0
-					i += 1
-				case '!': // ESC ! (tamaño de fuente, negrita, subrrayado)
-					flushBuffer()
-					isSmall = (next & 0x01) > 0
-					isBold = (next & 0x08) > 0
-					isDoubleY = (next & 0x10) > 0
-					isDoubleX = (next & 0x20) > 0
-					isUnderline = (next & 0x80) > 0
-					i += 2
-				case '-': // ESC - (subrayado)
-					flushBuffer()
-					isUnderline = next == 1 || next == 2 || next == '1' || next == '2'
-					i += 2
-				case '{': // ESC { (arriba/abajo)
-					flushBuffer()
-					isUpsideDown = next%2 == 1
-					i += 2
-				case 'E': // ESC E (negrita)
-					flushBuffer()
-					isBold = next%2 == 1
-					i += 2
-				case 'a': // ESC a (alineación)
-					flushBuffer()
-					switch next {
-					case 0, '0':
-						alignment = "left"
-					case 1, '1':
-						alignment = "center"
-					case 2, '2':
-						alignment = "right"
-					}
-					i += 2
-				case 'd': // ESC d (n saltos de línea)
-					flushBuffer()
-					for next > 0 {
-						writeToHtml("\n")
-						next--
-					}
-					col = 0
-					i += 2
-				case 'i', 'm': // ESC i (corte total) / ESC m (corte parcial)
-					flushBuffer()
-					if inLabel {
-						inLabel = false
-						io.WriteString(html, "</escpos>\n")
-					}
-					i += 2
-				case 'p': // ESC p (pulso)
-					i += 4
-				case 't': // ESC t (página de código) 16=WIN1252
-					i += 2
-				case 'q': // ESC q S E V M n1 n2 ... (QR SEIKO)
-					if i+8 < len(escpos) {
-						qrModulo := int(escpos[i+2])
-						qrECC := int(escpos[i+3])
-						z := int(escpos[i+6]) + int(escpos[i+7])*256
-						i += 8
-						if i+z < len(escpos) {
-							qrData := escpos[i : i+z]
-							flushBuffer()
-							writeToHtml(imprimeQR(qrData, qrModulo, qrECC))
-							i += z
-						}
-					}
-				case 'b': // ESC b n1 n2 n3 ... ESC J 0 (raster SEIKO)
-					if i+5 < len(escpos) {
-						w := int(escpos[i+2]) * 8
-						h := int(escpos[i+3]) + int(escpos[i+4])*256
-						z := w * h / 8
-						i += 5
-						if i+z+3 < len(escpos) && escpos[i+z] == ESC && escpos[i+z+1] == 'J' {
-							img = decodeRastrerImage(&escpos, i, z, w, h)
-							flushBuffer()
-							writeToHtml(encodeImage(img, alignment))
-							i += z + 3
-						}
-					}
+	for _, e := range ParseEscPos(escpos) {
+		switch e.Tipo {
+		case EscPosText:
+			espaciado := ""
+			if e.Estilo.Espaciado > 0 {
+				px := float64(e.Estilo.Espaciado) / 2
+				if e.Estilo.DobleAncho {
+					px *= 2
 				}
+				espaciado = fmt.Sprintf(` style="letter-spacing: %gpx;"`, px)
 			}
-
-		case GS:
-			if i+1 < len(escpos) {
-				var next byte
-				if i+2 < len(escpos) {
-					next = escpos[i+2]
-				}
-				switch escpos[i+1] {
-				case 'B': // GS B (blanco sobre negro)
-					flushBuffer()
-					isReverse = next%2 == 1
-					i += 2
-				case 'v':
-					// GS v 0 0 xL xH yL yH (raster EPSON)
-					if next == '0' && i+8 < len(escpos) {
-						w := (int(escpos[i+4]) + int(escpos[i+5])*256) * 8
-						h := int(escpos[i+6]) + int(escpos[i+7])*256
-						z := w * h / 8
-						i += 8
-						if i+z < len(escpos) {
-							img = decodeRastrerImage(&escpos, i, z, w, h)
-							flushBuffer()
-							writeToHtml(encodeImage(img, alignment))
-							i += z
-						}
-					}
-				case '(':
-					// GS (k (QR EPSON)
-					if next == 'k' && i+4 < len(escpos) {
-						z := int(escpos[i+3]) + int(escpos[i+4])*256
-						i += 4
-						// QR
-						if z == 3 && escpos[i+1] == '1' && escpos[i+2] == 67 {
-							qrModulo = int(escpos[i+3])
-						}
-						if z == 3 && escpos[i+1] == '1' && escpos[i+2] == 69 {
-							qrECC = int(escpos[i+3])
-						}
-						if z > 3 && escpos[i+1] == '1' && escpos[i+2] == 80 && escpos[i+3] == '0' {
-							qrData = escpos[i+4 : i+z+1]
-						}
-						if z == 3 && escpos[i+1] == '1' && escpos[i+2] == 81 && escpos[i+3] == '0' {
-							flushBuffer()
-							writeToHtml(imprimeQR(qrData, qrModulo, qrECC))
-						}
-						i += z
-					}
-				case 'h': // GS h (barcode height)
-					bcHeight = int(next)
-					i += 2
-				case 'w': // GS w (barcode width)
-					bcWidth = int(next)
-					i += 2
-				case 'H': // GS H (barcode show)
-					switch next {
-					case 0, '0':
-						bcHRI = barcode.None
-					case 1, '1':
-						bcHRI = barcode.Above
-					case 2, '2':
-						bcHRI = barcode.Below
-					case 3, '3':
-						bcHRI = barcode.Both
-					}
-					i += 2
-				case 'k': // GS k (print barcode)
-					z := 0
-					if next <= 7 {
-						i += 2
-						for i < len(escpos) {
-							if escpos[i+z+1] == 0 {
-								break
-							}
-							z++
-						}
-					}
-					if next >= 65 && next <= 79 {
-						i += 3
-						z = int(escpos[i])
-					}
-					if z > 0 {
-						codigo := string(escpos[i+1 : i+z+1])
-						flushBuffer()
-						writeToHtml(imprimeBC(codigo, next, bcWidth, bcHeight, bcHRI))
-						i += z
-					}
-				}
+			writeToHtml(fmt.Sprintf("<span class=\"%s\"%s>%s</span>", claseEstilo(e.Estilo), espaciado, escapaHTML.Replace(e.Texto)))
+		case EscPosLineFeed:
+			writeToHtml("\n")
+		case EscPosImage:
+			writeToHtml(encodeImage(e.Imagen, e.Estilo.Alineacion))
+		case EscPosBarcode:
+			writeToHtml(imprimeBC(e.Texto, e.Simbologia, e.Modulo, e.Altura, e.HRI))
+		case EscPosQR:
+			writeToHtml(imprimeQR(e.Datos, e.Modulo, e.ECC))
+		case EscPosCut:
+			cortada = inLabel
+		case EscPosDrawer, EscPosBeep:
+			// Tras un corte, el marcador se añade al final de la etiqueta anterior
+			c := cortada
+			cortada = false
+			writeToHtml(fmt.Sprintf("<span class=\"marker\">%s</span>\n", escapaHTML.Replace(marcadorPeriferico(e))))
+			cortada = c
+		case EscPosLayout:
+			// Se aplica con el siguiente contenido, fuera del modo página
+			maquetacion = estiloMaqueta(e)
+		case EscPosPageStart:
+			w, h := e.Ancho/2, e.Alto/2
+			transform := ""
+			switch e.Direccion {
+			case 1:
+				w, h = h, w
+				transform = fmt.Sprintf("translateY(%dpx) rotate(-90deg)", e.Alto/2)
+			case 2:
+				transform = fmt.Sprintf("translate(%dpx, %dpx) rotate(180deg)", e.Ancho/2, e.Alto/2)
+			case 3:
+				w, h = h, w
+				transform = fmt.Sprintf("translateX(%dpx) rotate(90deg)", e.Ancho/2)
 			}
-
-		case FS:
-			if i+1 < len(escpos) {
-				switch escpos[i+1] {
-				case '.': // Cancel Kanji character mode
-					i++
-				}
+			writeToHtml(fmt.Sprintf(`<div class="page" style="margin-left: %dpx; margin-top: %dpx; width: %dpx; height: %dpx;"><div style="width: %dpx; height: %dpx; transform: %s;">`,
+				e.X/2, e.Y/2, e.Ancho/2, e.Alto/2, w, h, transform))
+			enPagina = true
+		case EscPosPosition:
+			if bloqueAbierto {
+				io.WriteString(html, "</div>")
 			}
-
-		default: // Texto normal
-			newClass := getTextClass()
-			if newClass != currentClass {
-				flushBuffer()
-				currentClass = newClass
+			bloqueAbierto = true
+			writeToHtml(fmt.Sprintf(`<div class="block" style="left: %dpx; top: %dpx;">`, e.X/2, e.Y/2))
+		case EscPosPageEnd:
+			if bloqueAbierto {
+				bloqueAbierto = false
+				io.WriteString(html, "</div>")
 			}
-			col++
-			textBuffer.WriteByte(escpos[i])
+			io.WriteString(html, "</div></div>\n")
+			enPagina = false
 		}
 	}
 
-	flushBuffer()
 	if inLabel {
-		io.WriteString(html, "</escpos>\n")
+		cierraLabel()
+	}
+}
+
+// Estilo CSS del interlineado, margen izquierdo y ancho de impresión de un elemento EscPosLayout, vacío si son
+// los de por defecto, ver addEscPosHTML.
+func estiloMaqueta(e EscPosElement) string {
+	var estilo []string
+	if e.Interlineado > 0 {
+		estilo = append(estilo, fmt.Sprintf("line-height: %gpx;", float64(e.Interlineado)/2))
+	}
+	if e.X > 0 {
+		estilo = append(estilo, fmt.Sprintf("margin-left: %gpx;", float64(e.X)/2))
+	}
+	if e.Ancho > 0 {
+		estilo = append(estilo, fmt.Sprintf("max-width: %gpx;", float64(e.Ancho)/2))
+	}
+	return strings.Join(estilo, " ")
+}
+
+// Escapa los caracteres especiales HTML de los textos
+var escapaHTML = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Clases CSS de un estilo de texto
+func claseEstilo(estilo EscPosStyle) string {
+	class := []string{estilo.Alineacion}
+	if estilo.Negrita {
+		class = append(class, "bold")
+	}
+	if estilo.Subrayado {
+		class = append(class, "underline")
+	}
+	if estilo.DobleAncho && !estilo.DobleAlto {
+		class = append(class, "doubleX")
+	}
+	if !estilo.DobleAncho && estilo.DobleAlto {
+		class = append(class, "doubleY")
+	}
+	if estilo.DobleAlto && estilo.DobleAncho {
+		class = append(class, "double")
 	}
+	if estilo.Pequeno {
+		class = append(class, "small")
+	}
+	if estilo.FuenteC {
+		class = append(class, "fontc")
+	}
+	if estilo.Inverso {
+		class = append(class, "reverse")
+	}
+	if estilo.Invertido {
+		class = append(class, "upsidedown")
+	}
+	return strings.Join(class, " ")
 }
 
 // Codificar la imagen en png+base64
@@ -1220,8 +1263,29 @@ func decodeRastrerImage(escpos *[]byte, i, z, w, h int) *image.Gray {
 	return img
 }
 
+// Decodifica la definición de un gráfico NV: m fn a kc1 kc2 b xL xH yL yH c d1...dk
+// Devuelve nil si la definición está incompleta.
+func decodeNvImage(datos []byte) *image.Gray {
+	if len(datos) < 11 {
+		return nil
+	}
+	w := int(datos[6]) + int(datos[7])*256
+	h := int(datos[8]) + int(datos[9])*256
+	z := (w + 7) / 8 * h
+	if len(datos) < 11+z {
+		return nil
+	}
+	return decodeRastrerImage(&datos, 11, z, w, h)
+}
+
 // Genera un código de barras
-func imprimeBC(codigo string, bcKind byte, bcWidth, bcHeight int, hri barcode.HRI) string {
+func imprimeBC(codigo string, tipo barcode.KIND, bcWidth, bcHeight int, hri barcode.HRI) string {
+	svg, _ := barcode.GetBarcodeSVG(codigo, tipo, float64(bcWidth)*3/5, float64(bcHeight)/2, "#000", hri, true)
+	return svg
+}
+
+// Tipo de código de barras de un valor m de GS k
+func tipoBC(bcKind byte) barcode.KIND {
 	var tipo barcode.KIND
 	switch bcKind {
 	case 0, 65:
@@ -1245,14 +1309,10 @@ func imprimeBC(codigo string, bcKind byte, bcWidth, bcHeight int, hri barcode.HR
 	default:
 		tipo = barcode.C128X // Para el resto usamos CODE128 automático
 	}
-	svg, _ := barcode.GetBarcodeSVG(codigo, tipo, float64(bcWidth)*3/5, float64(bcHeight)/2, "#000", hri, true)
-	return svg
+	return tipo
 }
 
 func imprimeQR(qrData []byte, qrModulo, qrECC int) string {
-	if qrECC >= 48 {
-		qrECC -= 48
-	}
 	qr, err := go_qr.EncodeBinary(qrData, go_qr.Ecc(qrECC))
 	if err != nil {
 		return ""
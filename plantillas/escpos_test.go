@@ -1,8 +1,10 @@
 package plantillas_test
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/horus-es/go-util/v3/errores"
@@ -145,6 +147,31 @@ func TestGenerateSeikoPosPdf(t *testing.T) {
 	assert.Equal(t, t1, t2)
 }
 
+func TestGenerateEscPosPdfWkhtml(t *testing.T) {
+	// Cargar plantilla
+	plantilla, err := os.ReadFile("plantilla.escpos")
+	errores.PanicIfError(err)
+	// Fusionar plantilla con estructura factura
+	f, err := plantillas.MergeEscPosTemplate(
+		"escpos",
+		string(plantilla),
+		factura,
+		"/assets",
+		formato.DMA,
+		formato.EUR,
+	)
+	errores.PanicIfError(err)
+	// Convertir la plantilla fusionada a fichero esc/pos binario
+	prn, mm, err := plantillas.GenerateEscPos(f, plantillas.EPSON)
+	errores.PanicIfError(err)
+	// PDF generado con wkhtmltopdf a partir de la vista previa HTML
+	err = plantillas.GenerateEscPosPdfWkhtml(prn, "wkhtml_test_out.pdf", mm)
+	assert.NoError(t, err)
+	t1 := readPdfText(t, "wkhtml_test_expect.pdf")
+	t2 := readPdfText(t, "wkhtml_test_out.pdf")
+	assert.Equal(t, t1, t2)
+}
+
 func ExampleGenerateEscPosPdf() {
 	// Cargar plantilla
 	plantilla, err := os.ReadFile("plantilla.escpos")
@@ -168,3 +195,60 @@ func ExampleGenerateEscPosPdf() {
 	fmt.Println("Generado fichero recibo.pdf")
 	// Output: Generado fichero recibo.pdf
 }
+
+func TestWriteEscPosHTML(t *testing.T) {
+	t1, mm, err := plantillas.GenerateEscPos("{paper-width 58}Uno <1>\n{full-cut}", plantillas.EPSON)
+	errores.PanicIfError(err)
+	t2, _, err := plantillas.GenerateEscPos("{paper-width 58}{b}Dos{}\n{qr ABC}\n{full-cut}", plantillas.SEIKO)
+	errores.PanicIfError(err)
+	var html bytes.Buffer
+	err = plantillas.WriteEscPosHTML(&html, mm, t1, t2)
+	assert.NoError(t, err)
+	s := html.String()
+	assert.True(t, strings.HasPrefix(s, "<!DOCTYPE html>\n"))
+	assert.True(t, strings.HasSuffix(s, "</html>\n"))
+	assert.Contains(t, s, "width: 58mm;")
+	assert.Contains(t, s, "Uno &lt;1&gt;")
+	assert.Equal(t, 2, strings.Count(s, "<escpos>"))
+	assert.Contains(t, s, "<svg")
+	var fragmento bytes.Buffer
+	err = plantillas.WriteEscPosHTMLFragment(&fragmento, 0, t1)
+	assert.NoError(t, err)
+	s = fragmento.String()
+	assert.True(t, strings.HasPrefix(s, "<style>\n"))
+	assert.Contains(t, s, "width: 80mm;")
+	assert.NotContains(t, s, "<html>")
+	assert.Equal(t, 1, strings.Count(s, "<escpos>"))
+}
+
+func TestWriteEscPosHTMLCodigoEscapado(t *testing.T) {
+	// Flujo capturado con un CODE128 (GS k 73) cuyo texto HRI lleva marcas HTML
+	codigo := "{B<script>x&y</script>"
+	prn := append([]byte{plantillas.GS, 'H', 2, plantillas.GS, 'k', 73, byte(len(codigo))}, codigo...)
+	prn = append(prn, plantillas.LF)
+	var html bytes.Buffer
+	err := plantillas.WriteEscPosHTMLFragment(&html, 0, prn)
+	assert.NoError(t, err)
+	assert.NotContains(t, html.String(), "<script>")
+	assert.Contains(t, html.String(), "&lt;script&gt;x&amp;y&lt;/script&gt;")
+}
+
+func ExampleWriteEscPosHTML() {
+	// Cargar plantilla
+	plantilla, err := os.ReadFile("plantilla.escpos")
+	errores.PanicIfError(err)
+	// Fusionar plantilla con estructura factura
+	f, err := plantillas.MergeEscPosTemplate("escpos", string(plantilla), factura, "/assets", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	// Convertir la plantilla fusionada a fichero esc/pos binario
+	prn, mm, err := plantillas.GenerateEscPos(f, plantillas.EPSON)
+	errores.PanicIfError(err)
+	// Escribir la vista previa HTML, p.e. en un http.ResponseWriter
+	out, err := os.Create("recibo.html")
+	errores.PanicIfError(err)
+	defer out.Close()
+	err = plantillas.WriteEscPosHTML(out, mm, prn)
+	errores.PanicIfError(err)
+	fmt.Println("Generado fichero recibo.html")
+	// Output: Generado fichero recibo.html
+}
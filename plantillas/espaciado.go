@@ -0,0 +1,67 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Espaciado, fuentes y márgenes (EPSON y SEIKO), en puntos:
+//   - {line-spacing 40}: interlineado (0-255) (ESC 3); {line-spacing} vuelve al interlineado por defecto (ESC 2)
+//   - {char-spacing 2}: espacio a la derecha de cada carácter (0-255), doble en los estilos de doble ancho (ESC SP)
+//   - {font a}, {font b} o {font c}: fuente de los caracteres (ESC M). La fuente B equivale al estilo {s}, y los
+//     cambios de estilo posteriores vuelven a la fuente A o B según incluyan {s}
+//   - {left-margin 40}: margen izquierdo (GS L)
+//   - {print-width 512}: ancho del área de impresión a partir del margen (GS W)
+//
+// El margen y el ancho solo tienen efecto al principio de una línea y se mantienen tras los cortes, hasta un {reset}.
+
+var reLineSpacingEscPos = regexp.MustCompile(`{line-spacing(?: ([0-9]+))?}`)
+var reCharSpacingEscPos = regexp.MustCompile(`{char-spacing ([0-9]+)}`)
+var reFontEscPos = regexp.MustCompile(`{font (a|b|c)}`)
+var reLeftMarginEscPos = regexp.MustCompile(`{left-margin ([0-9]+)}`)
+var rePrintWidthEscPos = regexp.MustCompile(`{print-width ([0-9]+)}`)
+
+// Procesa los comandos de espaciado, fuentes y márgenes. Los valores fuera de rango se dejan sin procesar.
+func processEscPosEspaciado(escpos []byte) []byte {
+	result := reLineSpacingEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
+		submatches := reLineSpacingEscPos.FindSubmatch(match)
+		if submatches[1] == nil {
+			return []byte{ESC, '2'} // ESC 2
+		}
+		n, _ := strconv.Atoi(string(submatches[1]))
+		if n > 255 {
+			return match
+		}
+		return []byte{ESC, '3', byte(n)} // ESC 3 n
+	})
+	result = reCharSpacingEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		submatches := reCharSpacingEscPos.FindSubmatch(match)
+		n, _ := strconv.Atoi(string(submatches[1]))
+		if n > 255 {
+			return match
+		}
+		return []byte{ESC, ' ', byte(n)} // ESC SP n
+	})
+	result = reFontEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		submatches := reFontEscPos.FindSubmatch(match)
+		return []byte{ESC, 'M', submatches[1][0] - 'a'} // ESC M n
+	})
+	result = reLeftMarginEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		return ordenPuntos(reLeftMarginEscPos, match, 'L') // GS L nL nH
+	})
+	result = rePrintWidthEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		return ordenPuntos(rePrintWidthEscPos, match, 'W') // GS W nL nH
+	})
+	return result
+}
+
+// Orden GS x nL nH con el valor en puntos de un comando
+func ordenPuntos(re *regexp.Regexp, match []byte, orden byte) []byte {
+	submatches := re.FindSubmatch(match)
+	n, _ := strconv.Atoi(string(submatches[1]))
+	if n > 0xffff {
+		return match
+	}
+	return []byte{GS, orden, byte(n), byte(n >> 8)}
+}
@@ -0,0 +1,84 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEspaciado(t *testing.T) {
+	const ESC, GS = plantillas.ESC, plantillas.GS
+	bin, _, err := plantillas.GenerateEscPos("{line-spacing 40}{char-spacing 2}{font c}{left-margin 300}{print-width 512}{line-spacing}", plantillas.EPSON)
+	assert.NoError(t, err)
+	esperado := []byte{ESC, '3', 40, ESC, ' ', 2, ESC, 'M', 2, GS, 'L', 44, 1, GS, 'W', 0, 2, ESC, '2'}
+	assert.True(t, bytes.HasSuffix(bin, esperado))
+	// SEIKO igual que EPSON, STAR sin procesar
+	seiko, _, err := plantillas.GenerateEscPos("{line-spacing 40}{char-spacing 2}{font c}{left-margin 300}{print-width 512}{line-spacing}", plantillas.SEIKO)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(seiko, esperado))
+	bin, _, err = plantillas.GenerateEscPos("{font b}{left-margin 8}", plantillas.STAR)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "{font b}{left-margin 8}")
+	// Fuera de rango
+	problemas := plantillas.ValidateEscPos("{line-spacing 256}{print-width 70000}{font d}", plantillas.EscPosProfile{Nombre: "epson", Familia: plantillas.EPSON})
+	assert.Len(t, problemas, 3)
+}
+
+func TestParseEscPosEspaciado(t *testing.T) {
+	bin, _, err := plantillas.GenerateEscPos("{line-spacing 40}{left-margin 16}{char-spacing 3}{font c}A{s}B\n{reset}C", plantillas.EPSON)
+	errores.PanicIfError(err)
+	elementos := plantillas.ParseEscPos(bin)
+	var layouts []plantillas.EscPosElement
+	var textos []plantillas.EscPosStyle
+	for _, e := range elementos {
+		switch e.Tipo {
+		case plantillas.EscPosLayout:
+			layouts = append(layouts, e)
+		case plantillas.EscPosText:
+			textos = append(textos, e.Estilo)
+		}
+	}
+	if assert.Len(t, layouts, 3) {
+		assert.Equal(t, 40, layouts[0].Interlineado)
+		assert.Equal(t, 16, layouts[1].X)
+		assert.Equal(t, plantillas.EscPosElement{Tipo: plantillas.EscPosLayout}, layouts[2])
+	}
+	if assert.Len(t, textos, 3) {
+		// Fuente C con espaciado, el estilo {s} vuelve a la fuente B y el reset quita el espaciado
+		assert.Equal(t, plantillas.EscPosStyle{Alineacion: "left", Pequeno: true, FuenteC: true, Espaciado: 3}, textos[0])
+		assert.Equal(t, plantillas.EscPosStyle{Alineacion: "left", Pequeno: true, Espaciado: 3}, textos[1])
+		assert.Equal(t, plantillas.EscPosStyle{Alineacion: "left"}, textos[2])
+	}
+}
+
+func TestVistaPreviaEspaciado(t *testing.T) {
+	bin, mm, err := plantillas.GenerateEscPos("{line-spacing 60}{left-margin 100}{print-width 48}{char-spacing 4}{o}ABCDE{}\n{line-spacing}{left-margin 0}{print-width 0}{char-spacing 0}{o}A{}\n", plantillas.EPSON)
+	errores.PanicIfError(err)
+	img, err := plantillas.RenderEscPosImage(bin, mm)
+	assert.NoError(t, err)
+	if assert.Len(t, img, 1) {
+		// ABCDE en 2 líneas de 60 puntos, de 3 y 2 caracteres de 16 puntos desde el margen, y una línea de 30 puntos
+		assert.Equal(t, 60+60+30, img[0].Rect.Dy())
+		assert.Equal(t, uint8(255), img[0].GrayAt(99, 10).Y)
+		assert.Equal(t, uint8(0), img[0].GrayAt(100, 10).Y)
+		assert.Equal(t, uint8(0), img[0].GrayAt(147, 10).Y)
+		assert.Equal(t, uint8(255), img[0].GrayAt(148, 10).Y)
+		assert.Equal(t, uint8(0), img[0].GrayAt(131, 70).Y)
+		assert.Equal(t, uint8(255), img[0].GrayAt(132, 70).Y)
+		assert.Equal(t, uint8(0), img[0].GrayAt(0, 130).Y)
+	}
+	var pdf bytes.Buffer
+	err = plantillas.WriteEscPosPdf(&pdf, bin, mm)
+	assert.NoError(t, err)
+	_, contenido := leePdf(t, pdf.Bytes())
+	assert.Contains(t, contenido, "100 Tz 4 Tc 1 0 0 -1 100 ")
+	var html bytes.Buffer
+	err = plantillas.WriteEscPosHTMLFragment(&html, mm, bin)
+	assert.NoError(t, err)
+	assert.Contains(t, html.String(), `<div class="layout" style="line-height: 30px; margin-left: 50px; max-width: 24px;">`)
+	assert.Contains(t, html.String(), `<span class="left reverse" style="letter-spacing: 2px;">ABCDE</span>`)
+	assert.Contains(t, html.String(), "</div><span class=\"left reverse\">A</span></escpos>")
+}
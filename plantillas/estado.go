@@ -0,0 +1,155 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Estado de una impresora esc/pos, ver EscPosPrinter.Status y EscPosPrinter.ReadASB
+type EscPosStatus struct {
+	Offline            bool // Fuera de línea, normalmente por alguna de las causas siguientes
+	CajonAbierto       bool // Pin 3 del conector del cajón a nivel alto
+	TapaAbierta        bool // Tapa abierta
+	AvanceManual       bool // Avanzando papel con el botón FEED
+	SinPapel           bool // Fin de papel, la impresora se ha detenido
+	PocoPapel          bool // Papel próximo a agotarse
+	ErrorCortador      bool // Error del cortador automático
+	ErrorIrrecuperable bool // Error irrecuperable, requiere apagar la impresora
+	ErrorRecuperable   bool // Error recuperable automáticamente (p.e. temperatura del cabezal)
+}
+
+// Indica si la impresora está lista para imprimir
+func (s EscPosStatus) Ok() bool {
+	return !s.Offline && !s.TapaAbierta && !s.SinPapel && !s.ErrorCortador && !s.ErrorIrrecuperable && !s.ErrorRecuperable
+}
+
+// Consulta el estado en tiempo real de la impresora mediante DLE EOT 1 a 4.
+// En la familia SEIKO el estado del papel se consulta con GS r 1, ya que muchas impresoras de kiosko no implementan DLE EOT 4.
+// Requiere una conexión bidireccional (red, USB o serie).
+func (p *EscPosPrinter) Status(familia int) (s EscPosStatus, err error) {
+	var b byte
+	// Estado de la impresora
+	if b, err = p.consulta(DLE, 4, 1); err != nil {
+		return
+	}
+	s.CajonAbierto = b&0x04 != 0
+	s.Offline = b&0x08 != 0
+	// Causa de fuera de línea
+	if b, err = p.consulta(DLE, 4, 2); err != nil {
+		return
+	}
+	s.TapaAbierta = b&0x04 != 0
+	s.AvanceManual = b&0x08 != 0
+	s.SinPapel = b&0x20 != 0
+	// Causa de error
+	if b, err = p.consulta(DLE, 4, 3); err != nil {
+		return
+	}
+	s.ErrorCortador = b&0x08 != 0
+	s.ErrorIrrecuperable = b&0x20 != 0
+	s.ErrorRecuperable = b&0x40 != 0
+	// Sensor de papel
+	switch familia {
+	case SEIKO:
+		if b, err = p.consulta(GS, 'r', 1); err != nil {
+			return
+		}
+		s.PocoPapel = b&0x03 != 0
+		s.SinPapel = s.SinPapel || b&0x0c != 0
+	default:
+		if b, err = p.consulta(DLE, 4, 4); err != nil {
+			return
+		}
+		s.PocoPapel = b&0x0c != 0
+		s.SinPapel = s.SinPapel || b&0x60 != 0
+	}
+	return
+}
+
+// Envía una orden de estado y lee el byte de respuesta, descartando los bytes de ASB intercalados
+func (p *EscPosPrinter) consulta(orden ...byte) (byte, error) {
+	_, err := p.Write(orden)
+	if err != nil {
+		return 0, fmt.Errorf("impresora %s: %w", p.address, err)
+	}
+	b := make([]byte, 1)
+	for {
+		_, err = io.ReadFull(p, b)
+		if err != nil {
+			return 0, fmt.Errorf("impresora %s: sin respuesta de estado: %w", p.address, err)
+		}
+		// Los ASB empiezan por un byte de la forma 0xx1xx00 y los 3 bytes siguientes tienen la misma forma que las
+		// respuestas GS r, así que se descartan completos
+		if b[0]&0x93 == 0x10 {
+			if _, err = io.ReadFull(p, make([]byte, 3)); err != nil {
+				return 0, fmt.Errorf("impresora %s: sin respuesta de estado: %w", p.address, err)
+			}
+			continue
+		}
+		// Las respuestas DLE EOT tienen la forma 0xx1xx10, las de GS r 0xx0xxxx
+		if orden[0] == DLE && b[0]&0x93 == 0x12 || orden[0] == GS && b[0]&0x90 == 0 {
+			return b[0], nil
+		}
+	}
+}
+
+// Activa el envío automático de estado (ASB) mediante GS a, para todos los cambios de cajón, línea, error y papel.
+// Los estados se leen con ReadASB.
+func (p *EscPosPrinter) EnableASB() error {
+	_, err := p.Write([]byte{GS, 'a', 0x0f})
+	return err
+}
+
+// Desactiva el envío automático de estado (ASB)
+func (p *EscPosPrinter) DisableASB() error {
+	_, err := p.Write([]byte{GS, 'a', 0})
+	return err
+}
+
+// Espera y decodifica el siguiente estado automático (ASB) de 4 bytes enviado por la impresora tras EnableASB.
+// Ambas familias usan el mismo formato.
+func (p *EscPosPrinter) ReadASB() (s EscPosStatus, err error) {
+	asb := make([]byte, 4)
+	// Sincronizamos con el primer byte, de la forma 0xx1xx00
+	for {
+		if _, err = io.ReadFull(p, asb[:1]); err != nil {
+			return
+		}
+		if asb[0]&0x93 == 0x10 {
+			break
+		}
+	}
+	if _, err = io.ReadFull(p, asb[1:]); err != nil {
+		return
+	}
+	return DecodeASB(asb), nil
+}
+
+// Decodifica un estado automático (ASB) de 4 bytes
+func DecodeASB(asb []byte) (s EscPosStatus) {
+	if len(asb) < 4 {
+		return
+	}
+	s.CajonAbierto = asb[0]&0x04 != 0
+	s.Offline = asb[0]&0x08 != 0
+	s.TapaAbierta = asb[0]&0x20 != 0
+	s.AvanceManual = asb[0]&0x40 != 0
+	s.ErrorCortador = asb[1]&0x08 != 0
+	s.ErrorIrrecuperable = asb[1]&0x20 != 0
+	s.ErrorRecuperable = asb[1]&0x40 != 0
+	s.PocoPapel = asb[2]&0x03 != 0
+	s.SinPapel = asb[2]&0x0c != 0
+	return
+}
+
+// Consulta el estado de una impresora (ver DialEscPos para los formatos de address y EscPosPrinter.Status).
+func QueryEscPosStatus(address string, familia int, timeout time.Duration) (EscPosStatus, error) {
+	p, err := DialEscPos(address, timeout)
+	if err != nil {
+		return EscPosStatus{}, err
+	}
+	defer p.Close()
+	return p.Status(familia)
+}
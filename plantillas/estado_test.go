@@ -0,0 +1,99 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+// Impresora de red falsa que responde a las órdenes de estado. Antes de cada respuesta envía asb, si lo hay.
+func impresoraEstado(t *testing.T, respuestas map[string]byte, asb []byte) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				orden := make([]byte, 3)
+				for {
+					if _, err := conn.Read(orden); err != nil {
+						return
+					}
+					if bytes.Equal(orden, []byte{plantillas.GS, 'a', 0x0f}) {
+						conn.Write(asb)
+						continue
+					}
+					if r, ok := respuestas[string(orden)]; ok {
+						conn.Write(append(asb, r))
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestStatusEpson(t *testing.T) {
+	address := impresoraEstado(t, map[string]byte{
+		"\x10\x04\x01": 0x1e, // Fuera de línea, cajón abierto
+		"\x10\x04\x02": 0x36, // Tapa abierta, fin de papel
+		"\x10\x04\x03": 0x1a, // Error del cortador
+		"\x10\x04\x04": 0x1e, // Poco papel
+	}, []byte{0x10, 0, 0, 0}) // ASB intercalado que se descarta
+	s, err := plantillas.QueryEscPosStatus(address, plantillas.EPSON, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, plantillas.EscPosStatus{Offline: true, CajonAbierto: true, TapaAbierta: true, SinPapel: true, ErrorCortador: true, PocoPapel: true}, s)
+	assert.False(t, s.Ok())
+}
+
+func TestStatusSeiko(t *testing.T) {
+	address := impresoraEstado(t, map[string]byte{
+		"\x10\x04\x01": 0x12,
+		"\x10\x04\x02": 0x12,
+		"\x10\x04\x03": 0x12,
+		"\x1dr\x01":    0x03, // Poco papel
+	}, nil)
+	s, err := plantillas.QueryEscPosStatus(address, plantillas.SEIKO, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, plantillas.EscPosStatus{PocoPapel: true}, s)
+	assert.True(t, s.Ok())
+}
+
+func TestStatusSeikoASB(t *testing.T) {
+	address := impresoraEstado(t, map[string]byte{
+		"\x10\x04\x01": 0x12,
+		"\x10\x04\x02": 0x12,
+		"\x10\x04\x03": 0x12,
+		"\x1dr\x01":    0x00, // Papel correcto
+	}, []byte{0x10, 0x0c, 0x0c, 0x00}) // ASB intercalado, cuyos bytes parecen respuestas GS r de fin de papel
+	s, err := plantillas.QueryEscPosStatus(address, plantillas.SEIKO, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, plantillas.EscPosStatus{}, s)
+	assert.True(t, s.Ok())
+}
+
+func TestStatusSinRespuesta(t *testing.T) {
+	address := impresoraEstado(t, map[string]byte{}, nil)
+	_, err := plantillas.QueryEscPosStatus(address, plantillas.EPSON, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestReadASB(t *testing.T) {
+	address := impresoraEstado(t, nil, []byte{0x38, 0x40, 0x0c, 0x00}) // Fuera de línea, tapa abierta, error recuperable, sin papel
+	p, err := plantillas.DialEscPos(address, time.Second)
+	assert.NoError(t, err)
+	defer p.Close()
+	assert.NoError(t, p.EnableASB())
+	s, err := p.ReadASB()
+	assert.NoError(t, err)
+	assert.Equal(t, plantillas.EscPosStatus{Offline: true, TapaAbierta: true, ErrorRecuperable: true, SinPapel: true}, s)
+}
@@ -0,0 +1,308 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modos de conversión de imágenes a blanco y negro del comando {img}
+const (
+	IMG_THRESHOLD = "threshold" // Umbral en el punto medio, adecuado para logotipos de colores planos
+	IMG_FLOYD     = "floyd"     // Difusión de error Floyd-Steinberg, adecuado para fotografías
+	IMG_ORDERED   = "ordered"   // Matriz de Bayer 8x8, adecuado para degradados
+)
+
+// Opciones del comando {img fichero mode=... width=...}
+type tOpcionesImg struct {
+	fichero string
+	modo    string
+	ancho   int // Ancho en puntos, 0 para el de la imagen
+}
+
+// Separa el fichero y las opciones de un comando {img}. Las opciones van al final y el nombre del fichero puede contener espacios.
+func parseOpcionesImg(arg string) (opciones tOpcionesImg, err error) {
+	opciones.modo = IMG_THRESHOLD
+	partes := strings.Fields(arg)
+	n := len(partes)
+	for n > 1 {
+		clave, valor, ok := strings.Cut(partes[n-1], "=")
+		if !ok {
+			break
+		}
+		switch clave {
+		case "mode":
+			if valor != IMG_THRESHOLD && valor != IMG_FLOYD && valor != IMG_ORDERED {
+				return opciones, fmt.Errorf("modo de imagen %q no soportado", valor)
+			}
+			opciones.modo = valor
+		case "width":
+			opciones.ancho, err = strconv.Atoi(valor)
+			if err != nil || opciones.ancho < 1 {
+				return opciones, fmt.Errorf("ancho de imagen %q no válido", valor)
+			}
+		default:
+			return opciones, fmt.Errorf("opción de imagen %q no soportada", clave)
+		}
+		n--
+	}
+	opciones.fichero = strings.Join(partes[:n], " ")
+	return
+}
+
+// Ancho imprimible en puntos de un papel, a 203 ppp
+func puntosPapel(mm int) int {
+	switch mm {
+	case 58:
+		return 384
+	case 80:
+		return 576
+	case 112:
+		return 832
+	}
+	return mm * 36 / 5 &^ 7 // 72 mm imprimibles de cada 80
+}
+
+// Imagen rasterizada en caché
+type tImagenCache struct {
+	modificado time.Time
+	tamano     int64
+	data       []byte
+	width      int
+	height     int
+}
+
+// Número máximo de imágenes en caché, al superarlo se vacía
+const maxCacheImagenes = 64
+
+var cacheImagenes = map[string]tImagenCache{}
+var cacheMutex sync.Mutex
+
+// Vacía la caché de imágenes rasterizadas. Normalmente no es necesario, ya que las imágenes se
+// vuelven a rasterizar si cambia la fecha de modificación o el tamaño del fichero.
+func ClearEscPosImageCache() {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	cacheImagenes = map[string]tImagenCache{}
+}
+
+// "Rasteriza" la imagen de un comando {img}, ajustándola a un ancho imprimible de puntos (0 sin límite).
+// Las imágenes se guardan en caché por ruta, opciones y fecha de modificación.
+func rasterizeImg(arg string, puntos int) (data []byte, width, height int, err error) {
+	opciones, err := parseOpcionesImg(arg)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(opciones.fichero)
+	if err != nil {
+		return
+	}
+	ruta, err := filepath.Abs(opciones.fichero)
+	if err != nil {
+		return
+	}
+	clave := fmt.Sprintf("%s|%s|%d|%d", ruta, opciones.modo, opciones.ancho, puntos)
+	cacheMutex.Lock()
+	c, ok := cacheImagenes[clave]
+	cacheMutex.Unlock()
+	if ok && c.modificado.Equal(info.ModTime()) && c.tamano == info.Size() {
+		return c.data, c.width, c.height, nil
+	}
+	data, width, height, err = rasterizeOpciones(opciones, puntos)
+	if err != nil {
+		return
+	}
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	if len(cacheImagenes) >= maxCacheImagenes {
+		cacheImagenes = map[string]tImagenCache{}
+	}
+	cacheImagenes[clave] = tImagenCache{modificado: info.ModTime(), tamano: info.Size(), data: data, width: width, height: height}
+	return
+}
+
+// Auxiliar de rasterizeImg
+func rasterizeOpciones(opciones tOpcionesImg, puntos int) (data []byte, width, height int, err error) {
+	f, err := os.Open(opciones.fichero)
+	if err != nil {
+		return
+	}
+	config, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return
+	}
+	width = config.Width
+	if opciones.ancho > 0 {
+		width = opciones.ancho
+	}
+	if puntos > 0 {
+		width = min(width, puntos)
+	}
+	if opciones.modo == IMG_THRESHOLD && width == config.Width {
+		// Sin escalado: umbral original
+		return rasterize(opciones.fichero)
+	}
+	f, err = os.Open(opciones.fichero)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return
+	}
+	lum, width, height := luminancia(img, width)
+	switch opciones.modo {
+	case IMG_FLOYD:
+		data = floydSteinberg(lum, width, height)
+	case IMG_ORDERED:
+		data = bayer(lum, width, height)
+	default:
+		data = umbralMedio(lum, width, height)
+	}
+	return
+}
+
+// Convierte una imagen en una matriz de luminancias (0 negro, 1 blanco) sobre fondo blanco, escalada al ancho indicado.
+// El escalado promedia el área de la imagen original que cubre cada punto.
+func luminancia(img image.Image, ancho int) (lum []float64, width, height int) {
+	bounds := img.Bounds()
+	w0, h0 := bounds.Dx(), bounds.Dy()
+	width = ancho
+	height = max(1, int(math.Round(float64(h0)*float64(ancho)/float64(w0))))
+	original := make([]float64, w0*h0)
+	for y := 0; y < h0; y++ {
+		for x := 0; x < w0; x++ {
+			r, g, b, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			alfa := float64(a) / 0xffff
+			original[y*w0+x] = (0.299*float64(r)+0.587*float64(g)+0.114*float64(b))/0xffff + 1 - alfa
+		}
+	}
+	if width == w0 && height == h0 {
+		return original, width, height
+	}
+	lum = make([]float64, width*height)
+	fx := float64(w0) / float64(width)
+	fy := float64(h0) / float64(height)
+	for y := 0; y < height; y++ {
+		y0, y1 := float64(y)*fy, float64(y+1)*fy
+		for x := 0; x < width; x++ {
+			x0, x1 := float64(x)*fx, float64(x+1)*fx
+			var suma, area float64
+			for sy := int(y0); sy < h0 && float64(sy) < y1; sy++ {
+				cy := math.Min(y1, float64(sy+1)) - math.Max(y0, float64(sy))
+				for sx := int(x0); sx < w0 && float64(sx) < x1; sx++ {
+					c := cy * (math.Min(x1, float64(sx+1)) - math.Max(x0, float64(sx)))
+					suma += c * original[sy*w0+sx]
+					area += c
+				}
+			}
+			lum[y*width+x] = suma / area
+		}
+	}
+	return
+}
+
+// Empaqueta un punto negro en los datos raster
+func puntoNegro(data []byte, width, x, y int) {
+	data[y*((width+7)>>3)+x/8] |= 128 >> (x % 8)
+}
+
+// Binariza con umbral en el punto medio entre la luminancia mínima y la máxima
+func umbralMedio(lum []float64, width, height int) []byte {
+	data := make([]byte, ((width+7)>>3)*height)
+	minimo, maximo := 1.0, 0.0
+	for _, l := range lum {
+		minimo = math.Min(minimo, l)
+		maximo = math.Max(maximo, l)
+	}
+	umbral := (minimo + maximo) / 2
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if lum[y*width+x] < umbral {
+				puntoNegro(data, width, x, y)
+			}
+		}
+	}
+	return data
+}
+
+// Binariza con difusión de error Floyd-Steinberg
+func floydSteinberg(lum []float64, width, height int) []byte {
+	data := make([]byte, ((width+7)>>3)*height)
+	acumulado := make([]float64, len(lum))
+	copy(acumulado, lum)
+	difunde := func(x, y int, e float64) {
+		if x >= 0 && x < width && y < height {
+			acumulado[y*width+x] += e
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := acumulado[y*width+x]
+			nuevo := 1.0
+			if v < 0.5 {
+				nuevo = 0
+				puntoNegro(data, width, x, y)
+			}
+			e := v - nuevo
+			difunde(x+1, y, e*7/16)
+			difunde(x-1, y+1, e*3/16)
+			difunde(x, y+1, e*5/16)
+			difunde(x+1, y+1, e*1/16)
+		}
+	}
+	return data
+}
+
+// Matriz de Bayer 8x8
+var matrizBayer = [8][8]float64{
+	{0, 32, 8, 40, 2, 34, 10, 42},
+	{48, 16, 56, 24, 50, 18, 58, 26},
+	{12, 44, 4, 36, 14, 46, 6, 38},
+	{60, 28, 52, 20, 62, 30, 54, 22},
+	{3, 35, 11, 43, 1, 33, 9, 41},
+	{51, 19, 59, 27, 49, 17, 57, 25},
+	{15, 47, 7, 39, 13, 45, 5, 37},
+	{63, 31, 55, 23, 61, 29, 53, 21},
+}
+
+// Binariza con tramado ordenado (matriz de Bayer 8x8)
+func bayer(lum []float64, width, height int) []byte {
+	data := make([]byte, ((width+7)>>3)*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if lum[y*width+x] < (matrizBayer[y%8][x%8]+0.5)/64 {
+				puntoNegro(data, width, x, y)
+			}
+		}
+	}
+	return data
+}
+
+// Orden de impresión de una imagen raster según el perfil: RASTER_GS_V, RASTER_ESC_B o RASTER_ESC_GS_S
+func ordenRaster(orden string, raster []byte, width, height int) []byte {
+	ancho := (width + 7) >> 3
+	var datos []byte
+	switch orden {
+	case RASTER_GS_V:
+		datos = []byte{GS, 'v', '0', 0, byte(ancho), byte(ancho >> 8), byte(height), byte(height >> 8)} // GS v 0 0 xL xH yL yH
+		datos = append(datos, raster...)
+	case RASTER_ESC_B:
+		datos = []byte{ESC, 'b', byte(ancho), byte(height), byte(height >> 8)} // ESC b n1 n2 n3
+		datos = append(datos, raster...)
+		datos = append(datos, ESC, 'J', 0) // ESC J 0
+	case RASTER_ESC_GS_S:
+		datos = []byte{ESC, GS, 'S', 1, byte(ancho), byte(ancho >> 8), byte(height), byte(height >> 8), 0} // ESC GS S 1 xL xH yL yH 0
+		datos = append(datos, raster...)
+	}
+	return datos
+}
@@ -0,0 +1,96 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+// Crea una imagen gris uniforme de w x h
+func imagenGris(t *testing.T, w, h int, gris uint8) string {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetGray(x, y, color.Gray{gris})
+		}
+	}
+	fn := filepath.Join(t.TempDir(), "gris.png")
+	f, err := os.Create(fn)
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, png.Encode(f, img))
+	return fn
+}
+
+// Extrae el raster de una orden GS v 0 y devuelve ancho en bytes, alto y proporción de puntos negros
+func rasterEpson(t *testing.T, bin []byte) (int, int, float64) {
+	k := bytes.Index(bin, []byte{plantillas.GS, 'v', '0', 0})
+	if !assert.True(t, k >= 0, "sin imagen") {
+		return 0, 0, 0
+	}
+	x := int(bin[k+4]) + int(bin[k+5])*256
+	y := int(bin[k+6]) + int(bin[k+7])*256
+	negros := 0
+	for _, b := range bin[k+8 : k+8+x*y] {
+		negros += bits.OnesCount8(b)
+	}
+	return x, y, float64(negros) / float64(x*8*y)
+}
+
+func TestImgEscalado(t *testing.T) {
+	fn := imagenGris(t, 1000, 500, 128)
+	// Se reduce al ancho imprimible del papel de 58mm
+	bin, _, err := plantillas.GenerateEscPos("{paper-width 58}{img "+fn+" mode=floyd}", plantillas.EPSON)
+	assert.NoError(t, err)
+	x, y, negros := rasterEpson(t, bin)
+	assert.Equal(t, 384/8, x)
+	assert.Equal(t, 192, y)
+	assert.InDelta(t, 0.5, negros, 0.05)
+	// Ancho explícito
+	bin, _, err = plantillas.GenerateEscPos("{img "+fn+" mode=ordered width=200}", plantillas.EPSON)
+	assert.NoError(t, err)
+	x, y, negros = rasterEpson(t, bin)
+	assert.Equal(t, 25, x)
+	assert.Equal(t, 100, y)
+	assert.InDelta(t, 0.5, negros, 0.05)
+}
+
+func TestImgOpciones(t *testing.T) {
+	fn := imagenGris(t, 100, 50, 20)
+	bin, _, err := plantillas.GenerateEscPos("{img "+fn+" mode=threshold width=64}", plantillas.EPSON)
+	assert.NoError(t, err)
+	x, y, _ := rasterEpson(t, bin)
+	assert.Equal(t, 8, x)
+	assert.Equal(t, 32, y)
+	// Las opciones desconocidas dejan el comando sin procesar
+	bin, _, err = plantillas.GenerateEscPos("{img "+fn+" mode=sepia}", plantillas.EPSON)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "mode=sepia}")
+}
+
+func TestImgCache(t *testing.T) {
+	fn := imagenGris(t, 64, 16, 0)
+	bin, _, err := plantillas.GenerateEscPos("{img "+fn+" mode=floyd}", plantillas.EPSON)
+	assert.NoError(t, err)
+	_, _, negros := rasterEpson(t, bin)
+	assert.Equal(t, 1.0, negros)
+	// Al cambiar el fichero se vuelve a rasterizar
+	nuevo := imagenGris(t, 64, 16, 255)
+	assert.NoError(t, os.Rename(nuevo, fn))
+	futuro := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(fn, futuro, futuro))
+	bin, _, err = plantillas.GenerateEscPos("{img "+fn+" mode=floyd}", plantillas.EPSON)
+	assert.NoError(t, err)
+	_, _, negros = rasterEpson(t, bin)
+	assert.Equal(t, 0.0, negros)
+	plantillas.ClearEscPosImageCache()
+}
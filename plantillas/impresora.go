@@ -0,0 +1,180 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Puerto por defecto de las impresoras de red (RAW)
+const PUERTO_ESCPOS = 9100
+
+// Pausa entre reintentos de PrintEscPos
+const esperaReintento = 500 * time.Millisecond
+
+// Dispositivos de Windows: COM1, LPT1, \\.\COM10 ...
+var reDispositivoWindows = regexp.MustCompile(`(?i)^(\\\\\.\\)?(COM|LPT)[0-9]+$`)
+
+// Conexión con una impresora esc/pos
+type EscPosPrinter struct {
+	address string
+	timeout time.Duration
+	conn    net.Conn // Impresora de red
+	file    *os.File // Dispositivo o fichero
+}
+
+// Abre la conexión con una impresora esc/pos. Formatos de address:
+//   - tcp://host:puerto, host:puerto o tcp://host: impresora de red en modo RAW (por defecto puerto 9100)
+//   - /dev/usb/lp0, /dev/ttyUSB0, COM3, LPT1: dispositivo de caracteres USB, serie o paralelo. Los parámetros del puerto serie se configuran previamente (stty, mode)
+//   - file://ruta o cualquier otra ruta: fichero, que se crea o se trunca
+//
+// El timeout se aplica a la conexión y a cada operación de lectura o escritura. Cero significa sin timeout.
+func DialEscPos(address string, timeout time.Duration) (*EscPosPrinter, error) {
+	p := &EscPosPrinter{address: address, timeout: timeout}
+	tipo, destino := tipoDireccion(address)
+	var err error
+	switch tipo {
+	case "tcp":
+		p.conn, err = net.DialTimeout("tcp", destino, timeout)
+	case "dev":
+		p.file, err = os.OpenFile(destino, os.O_RDWR, 0)
+		if err != nil {
+			// Algunos dispositivos son de solo escritura
+			p.file, err = os.OpenFile(destino, os.O_WRONLY, 0)
+		}
+	default:
+		p.file, err = os.OpenFile(destino, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("impresora %s: %w", address, err)
+	}
+	return p, nil
+}
+
+// Clasifica una dirección de impresora en tcp, dev o file, devolviendo el destino normalizado
+func tipoDireccion(address string) (tipo, destino string) {
+	switch {
+	case strings.HasPrefix(address, "tcp://"):
+		destino = strings.TrimPrefix(address, "tcp://")
+		if _, _, err := net.SplitHostPort(destino); err != nil {
+			destino = net.JoinHostPort(destino, strconv.Itoa(PUERTO_ESCPOS))
+		}
+		return "tcp", destino
+	case strings.HasPrefix(address, "file://"):
+		return "file", strings.TrimPrefix(address, "file://")
+	case strings.HasPrefix(address, "/dev/") || reDispositivoWindows.MatchString(address):
+		return "dev", address
+	}
+	if _, puerto, err := net.SplitHostPort(address); err == nil {
+		if _, err := strconv.Atoi(puerto); err == nil {
+			return "tcp", address
+		}
+	}
+	return "file", address
+}
+
+// Envía datos a la impresora
+func (p *EscPosPrinter) Write(bin []byte) (int, error) {
+	if p.conn != nil {
+		if p.timeout > 0 {
+			p.conn.SetWriteDeadline(time.Now().Add(p.timeout))
+		}
+		return p.conn.Write(bin)
+	}
+	return conTimeout(p.file, p.timeout, p.file.SetWriteDeadline, func() (int, error) { return p.file.Write(bin) })
+}
+
+// Lee datos de la impresora, p.e. respuestas de estado. Los ficheros no devuelven datos.
+func (p *EscPosPrinter) Read(buf []byte) (int, error) {
+	if p.conn != nil {
+		if p.timeout > 0 {
+			p.conn.SetReadDeadline(time.Now().Add(p.timeout))
+		}
+		return p.conn.Read(buf)
+	}
+	return conTimeout(p.file, p.timeout, p.file.SetReadDeadline, func() (int, error) { return p.file.Read(buf) })
+}
+
+// Cierra la conexión con la impresora
+func (p *EscPosPrinter) Close() error {
+	if p.conn != nil {
+		return p.conn.Close()
+	}
+	err := p.file.Close()
+	if errors.Is(err, os.ErrClosed) {
+		// Ya cerrado por conTimeout al vencer el timeout
+		return nil
+	}
+	return err
+}
+
+// Ejecuta una operación de E/S sobre un fichero o dispositivo con timeout.
+// Si el dispositivo no admite plazos (deadlines), la operación se abandona al vencer el timeout y el fichero se cierra.
+func conTimeout(f *os.File, timeout time.Duration, plazo func(time.Time) error, op func() (int, error)) (int, error) {
+	if timeout <= 0 {
+		return op()
+	}
+	if plazo(time.Now().Add(timeout)) == nil {
+		return op()
+	}
+	type resultado struct {
+		n   int
+		err error
+	}
+	ch := make(chan resultado, 1)
+	go func() {
+		n, err := op()
+		ch <- resultado{n, err}
+	}()
+	select {
+	case r := <-ch:
+		return r.n, r.err
+	case <-time.After(timeout):
+		// Al cerrar el fichero la operación bloqueada suele terminar; se espera otro timeout como máximo para saber
+		// cuántos bytes llegó a transferir
+		f.Close()
+		select {
+		case r := <-ch:
+			return r.n, os.ErrDeadlineExceeded
+		case <-time.After(timeout):
+			return 0, os.ErrDeadlineExceeded
+		}
+	}
+}
+
+// Envía un esc/pos binario (ver GenerateEscPos) a una impresora (ver DialEscPos para los formatos de address).
+// Si falla la conexión o el envío antes de escribir ningún byte, se reintenta hasta reintentos veces.
+// Si el envío falla a medias no se reintenta, para no imprimir el documento duplicado.
+func PrintEscPos(address string, bin []byte, timeout time.Duration, reintentos int) (err error) {
+	for intento := 0; intento <= reintentos; intento++ {
+		if intento > 0 {
+			time.Sleep(esperaReintento)
+		}
+		var n int
+		n, err = printEscPos(address, bin, timeout)
+		if err == nil || n > 0 {
+			return
+		}
+	}
+	return
+}
+
+// Auxiliar de PrintEscPos, devuelve el número de bytes enviados
+func printEscPos(address string, bin []byte, timeout time.Duration) (int, error) {
+	p, err := DialEscPos(address, timeout)
+	if err != nil {
+		return 0, err
+	}
+	n, err := p.Write(bin)
+	err = errors.Join(err, p.Close())
+	if err != nil {
+		return n, fmt.Errorf("impresora %s: %w", address, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,84 @@
+package plantillas_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+// Impresora de red falsa: devuelve su dirección y un canal con lo recibido en cada conexión
+func impresoraFalsa(t *testing.T, ln net.Listener) (string, chan []byte) {
+	recibido := make(chan []byte, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			datos, _ := io.ReadAll(conn)
+			conn.Close()
+			recibido <- datos
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String(), recibido
+}
+
+func TestPrintEscPosTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address, recibido := impresoraFalsa(t, ln)
+	bin := []byte{plantillas.ESC, '@', 'H', 'o', 'l', 'a', plantillas.LF}
+	err = plantillas.PrintEscPos("tcp://"+address, bin, time.Second, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, bin, <-recibido)
+	err = plantillas.PrintEscPos(address, bin, time.Second, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, bin, <-recibido)
+}
+
+func TestPrintEscPosReintentos(t *testing.T) {
+	// Puerto libre en el que la impresora tarda en arrancar
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := ln.Addr().String()
+	ln.Close()
+	err = plantillas.PrintEscPos(address, []byte("x"), time.Second, 0)
+	assert.Error(t, err)
+	listo := make(chan chan []byte)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		ln, err := net.Listen("tcp", address)
+		if err != nil {
+			close(listo)
+			return
+		}
+		_, recibido := impresoraFalsa(t, ln)
+		listo <- recibido
+	}()
+	err = plantillas.PrintEscPos(address, []byte("x"), time.Second, 3)
+	assert.NoError(t, err)
+	recibido := <-listo
+	if assert.NotNil(t, recibido) {
+		assert.Equal(t, []byte("x"), <-recibido)
+	}
+}
+
+func TestPrintEscPosFile(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "ticket.prn")
+	err := plantillas.PrintEscPos(fn, []byte("primero"), time.Second, 0)
+	assert.NoError(t, err)
+	err = plantillas.PrintEscPos("file://"+fn, []byte("segundo"), time.Second, 0)
+	assert.NoError(t, err)
+	datos, err := os.ReadFile(fn)
+	assert.NoError(t, err)
+	assert.Equal(t, "segundo", string(datos))
+	err = plantillas.PrintEscPos("/dev/no-existe", []byte("x"), time.Second, 1)
+	assert.Error(t, err)
+}
@@ -0,0 +1,144 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+)
+
+// Desglose de impuestos para las plantillas esc/pos y XHTML. Las líneas se agrupan por tipo impositivo y en cada
+// grupo se redondean la base, la cuota y el total a la unidad monetaria de la moneda (la de los decimales de PRICE):
+//   - {{$iva := VAT .Lines "Price" "VatRate"}}: importes sin impuestos (facturas). Base = suma de importes,
+//     cuota = base × tipo, total = base + cuota
+//   - {{$iva := VATINC .Lines "Price" "VatRate"}}: importes con impuestos incluidos (tickets). Total = suma de importes,
+//     base = total / (1 + tipo), cuota = total - base
+//
+// Las líneas son un slice o array de structs o mapas. El importe es el nombre de un campo numérico y el tipo el de
+// otro campo con el tipo en % o un número fijo para todas las líneas, p.e. {{VAT .Lines "Price" 21}}.
+// El resultado se imprime con PRICE:
+//
+//	{{range $iva.Tipos}}IVA {{.Tipo}}%: {{PRICE .Base}} {{PRICE .Cuota}}{{end}}
+//	Total: {{PRICE $iva.Total}}
+
+// Desglose de impuestos de unas líneas, ver las funciones VAT y VATINC de las plantillas
+type VatBreakdown struct {
+	Tipos []VatGroup // Grupos por tipo impositivo, de menor a mayor
+	Base  float64    // Suma de las bases imponibles
+	Cuota float64    // Suma de las cuotas
+	Total float64    // Suma de los totales
+}
+
+// Grupo de líneas con el mismo tipo impositivo
+type VatGroup struct {
+	Tipo   float64 // Tipo impositivo en %, p.e. 21
+	Lineas int     // Número de líneas del grupo
+	Base   float64 // Base imponible
+	Cuota  float64 // Cuota del impuesto
+	Total  float64 // Base más cuota
+}
+
+// Funciones de impuestos comunes a MergeEscPosTemplate y MergeXhtmlTemplate
+func funcionesImpuestos(fp formato.Moneda) map[string]any {
+	return map[string]any{
+		"VAT": func(lineas any, importe string, tipo any) VatBreakdown {
+			return desgloseImpuestos(lineas, importe, tipo, false, fp)
+		},
+		"VATINC": func(lineas any, importe string, tipo any) VatBreakdown {
+			return desgloseImpuestos(lineas, importe, tipo, true, fp)
+		},
+	}
+}
+
+// Agrupa las líneas por tipo impositivo y calcula bases, cuotas y totales redondeados.
+// Si incluido es true, los importes llevan el impuesto incluido.
+func desgloseImpuestos(lineas any, importe string, tipo any, incluido bool, fp formato.Moneda) (d VatBreakdown) {
+	um := unidadMonetaria(fp)
+	redondea := func(p float64) float64 {
+		return formato.RedondeaPrecio(p, um, formato.ESTANDAR)
+	}
+	v := reflect.ValueOf(lineas)
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	errores.PanicIfTrue(v.Kind() != reflect.Slice && v.Kind() != reflect.Array, "líneas de tipo %T no soportadas", lineas)
+	importes := map[float64]float64{}
+	cuenta := map[float64]int{}
+	for k := range v.Len() {
+		linea := v.Index(k)
+		t, ok := numero(tipo)
+		if !ok {
+			campo, esCampo := tipo.(string)
+			errores.PanicIfTrue(!esCampo, "tipo impositivo %v no soportado", tipo)
+			t = campoNumerico(linea, campo, k)
+		}
+		importes[t] += campoNumerico(linea, importe, k)
+		cuenta[t]++
+	}
+	for t, suma := range importes {
+		g := VatGroup{Tipo: t, Lineas: cuenta[t]}
+		if incluido {
+			g.Total = redondea(suma)
+			g.Base = redondea(g.Total / (1 + t/100))
+			g.Cuota = redondea(g.Total - g.Base)
+		} else {
+			g.Base = redondea(suma)
+			g.Cuota = redondea(g.Base * t / 100)
+			g.Total = redondea(g.Base + g.Cuota)
+		}
+		d.Tipos = append(d.Tipos, g)
+	}
+	sort.Slice(d.Tipos, func(i, j int) bool { return d.Tipos[i].Tipo < d.Tipos[j].Tipo })
+	for _, g := range d.Tipos {
+		d.Base = redondea(d.Base + g.Base)
+		d.Cuota = redondea(d.Cuota + g.Cuota)
+		d.Total = redondea(d.Total + g.Total)
+	}
+	return
+}
+
+// Unidad monetaria mínima de una moneda, según los decimales por defecto de formato.PrintPrecio. 0 si no se conocen.
+func unidadMonetaria(fp formato.Moneda) float64 {
+	switch fp {
+	case formato.EUR, formato.USD:
+		return 0.01
+	case formato.COP, formato.MXN:
+		return 1
+	}
+	return 0
+}
+
+// Valor numérico de un campo de una línea (struct o mapa)
+func campoNumerico(linea reflect.Value, campo string, k int) float64 {
+	for linea.Kind() == reflect.Pointer || linea.Kind() == reflect.Interface {
+		linea = linea.Elem()
+	}
+	var v reflect.Value
+	switch linea.Kind() {
+	case reflect.Struct:
+		v = linea.FieldByName(campo)
+	case reflect.Map:
+		v = linea.MapIndex(reflect.ValueOf(campo))
+	}
+	errores.PanicIfTrue(!v.IsValid(), "línea %d: campo %s no encontrado", k+1, campo)
+	n, ok := numero(v.Interface())
+	errores.PanicIfTrue(!ok, "línea %d: campo %s no numérico", k+1, campo)
+	return n
+}
+
+// Convierte un valor numérico a float64
+func numero(x any) (float64, bool) {
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), !math.IsNaN(v.Float())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	}
+	return 0, false
+}
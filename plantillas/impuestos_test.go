@@ -0,0 +1,65 @@
+package plantillas_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleMergeEscPosTemplate_impuestos() {
+	plantilla := `{paper-width 58}{{with VATINC .Lines "Price" .VatRate}}{{range .Tipos}}{{COLS "l* r8 r8" (printf "IVA %g%%" .Tipo) (PRICE .Base) (PRICE .Cuota)}}
+{{end}}{{COLS "l* r8" "Total" (PRICE .Total)}}{{end}}`
+	f, err := plantillas.MergeEscPosTemplate("impuestos", plantilla, factura, "", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	fmt.Println(f)
+	// Output:
+	// {paper-width 58}IVA 21%          7,40 €   1,56 €
+	// Total                     8,96 €
+}
+
+func TestDesgloseImpuestos(t *testing.T) {
+	merge := func(plantilla string, datos any, fp formato.Moneda) string {
+		f, err := plantillas.MergeEscPosTemplate("impuestos", plantilla, datos, "", formato.DMA, fp)
+		assert.NoError(t, err)
+		return f
+	}
+	lineas := []map[string]any{
+		{"Importe": 10.0, "IVA": 21},
+		{"Importe": 5, "IVA": 10},
+		{"Importe": 2.55, "IVA": 21},
+		{"Importe": 1.0, "IVA": 0},
+	}
+	datos := map[string]any{"Lines": lineas}
+	const resumen = `{{range .Tipos}}{{.Tipo}}:{{.Lineas}}:{{.Base}}:{{.Cuota}}:{{.Total}} {{end}}{{.Base}}:{{.Cuota}}:{{.Total}}`
+	// Importes sin impuestos, agrupados por tipo de menor a mayor
+	assert.Equal(t, "0:1:1:0:1 10:1:5:0.5:5.5 21:2:12.55:2.64:15.19 18.55:3.14:21.69",
+		merge(`{{with VAT .Lines "Importe" "IVA"}}`+resumen+`{{end}}`, datos, formato.EUR))
+	// Importes con impuestos incluidos
+	assert.Equal(t, "0:1:1:0:1 10:1:4.55:0.45:5 21:2:10.37:2.18:12.55 15.92:2.63:18.55",
+		merge(`{{with VATINC .Lines "Importe" "IVA"}}`+resumen+`{{end}}`, datos, formato.EUR))
+	// Tipo fijo y moneda sin decimales
+	pesos := map[string]any{"Lines": []map[string]any{{"Importe": 10000}, {"Importe": 2550}}}
+	assert.Equal(t, "19:2:12550:2385:14935 12550:2385:14935",
+		merge(`{{with VAT .Lines "Importe" 19}}`+resumen+`{{end}}`, pesos, formato.COP))
+	// Structs y formato con PRICE
+	assert.Equal(t, "    8,96 €     1,88 €    10,84 €",
+		merge(`{{with VAT .Lines "Price" .VatRate}}{{PRICE .Base}} {{PRICE .Cuota}} {{PRICE .Total}}{{end}}`, factura, formato.EUR))
+	// Sin líneas
+	assert.Equal(t, "0 0", merge(`{{$d := VAT .Lines "Price" 21}}{{len $d.Tipos}} {{$d.Total}}`, map[string]any{"Lines": []tLinea{}}, formato.EUR))
+	// Errores
+	for _, p := range []string{`{{VAT .Lines "Precio" 21}}`, `{{VAT .Lines "Price" "Service"}}`, `{{VAT .Lines "Price" true}}`, `{{VAT .Customer "Price" 21}}`} {
+		_, err := plantillas.MergeEscPosTemplate("impuestos", p, factura, "", formato.DMA, formato.EUR)
+		assert.Error(t, err, p)
+	}
+}
+
+func TestDesgloseImpuestosXhtml(t *testing.T) {
+	plantilla := `<p th:with="VAT .Lines &quot;Price&quot; .VatRate"><span th:each=".Tipos" th:text="{{PRICE .Cuota}}">x</span><b th:text="{{PRICE .Total}}">y</b></p>`
+	f, err := plantillas.MergeXhtmlTemplate("impuestos", plantilla, factura, "", formato.DMA, formato.EUR)
+	assert.NoError(t, err)
+	assert.Contains(t, f, "<span>1,88 €</span><b>10,84 €</b>")
+}
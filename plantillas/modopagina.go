@@ -0,0 +1,65 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// Modo página EPSON: el texto, los códigos y las imágenes se componen en un área de impresión con
+// posiciones absolutas y dirección de escritura, y se imprimen juntos al terminar la página.
+// Coordenadas y tamaños en puntos:
+//   - {page 576 400} o {page x y 576 400}: inicia el modo página con un área de impresión (ESC L, ESC W)
+//   - {page-dir 90}: dirección del texto, giro en sentido horario 0/90/180/270 (ESC T)
+//   - {pos 100 40}: posición absoluta horizontal y vertical en la dirección actual (ESC $, GS $)
+//   - {end-page}: imprime la página y vuelve al modo estándar (FF)
+
+var rePageEscPos = regexp.MustCompile(`{page ([0-9]+) ([0-9]+)(?: ([0-9]+) ([0-9]+))?}`)
+var rePageDirEscPos = regexp.MustCompile(`{page-dir (0|90|180|270)}`)
+var rePosEscPos = regexp.MustCompile(`{pos ([0-9]+) ([0-9]+)}`)
+var reEndPageEscPos = regexp.MustCompile(`{end-page}`)
+
+// Interlineado por defecto en puntos, para la vista previa del modo página
+const interlineadoPagina = 30
+
+// Dirección ESC T de cada giro
+var direccionesPagina = map[string]byte{"0": 0, "90": 3, "180": 2, "270": 1}
+
+// Procesa los comandos del modo página EPSON
+func processEpsonPage(escpos []byte) []byte {
+	result := rePageEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
+		submatches := rePageEscPos.FindSubmatch(match)
+		n := make([]int, 0, 4)
+		for _, s := range submatches[1:] {
+			if s != nil {
+				v, _ := strconv.Atoi(string(s))
+				n = append(n, v)
+			}
+		}
+		if len(n) == 2 {
+			n = []int{0, 0, n[0], n[1]}
+		}
+		datos := []byte{ESC, 'L', ESC, 'W'} // ESC L ESC W xL xH yL yH dxL dxH dyL dyH
+		for _, v := range n {
+			if v > 0xffff {
+				return match
+			}
+			datos = append(datos, byte(v), byte(v>>8))
+		}
+		return datos
+	})
+	result = rePageDirEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		submatches := rePageDirEscPos.FindSubmatch(match)
+		return []byte{ESC, 'T', direccionesPagina[string(submatches[1])]} // ESC T n
+	})
+	result = rePosEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		submatches := rePosEscPos.FindSubmatch(match)
+		x, _ := strconv.Atoi(string(submatches[1]))
+		y, _ := strconv.Atoi(string(submatches[2]))
+		if x > 0xffff || y > 0xffff {
+			return match
+		}
+		return []byte{ESC, '$', byte(x), byte(x >> 8), GS, '$', byte(y), byte(y >> 8)} // ESC $ nL nH GS $ nL nH
+	})
+	return reEndPageEscPos.ReplaceAll(result, []byte{FF})
+}
@@ -0,0 +1,27 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModoPagina(t *testing.T) {
+	bin, _, err := plantillas.GenerateEscPos("{page 576 300}{page-dir 90}{pos 10 300}TICKET{end-page}", plantillas.EPSON)
+	assert.NoError(t, err)
+	esperado := []byte{plantillas.ESC, 'L', plantillas.ESC, 'W', 0, 0, 0, 0, 64, 2, 44, 1} // ESC L ESC W 0 0 576 300
+	esperado = append(esperado, plantillas.ESC, 'T', 3)                                    // ESC T 3
+	esperado = append(esperado, plantillas.ESC, '$', 10, 0, plantillas.GS, '$', 44, 1)     // ESC $ 10 GS $ 300
+	esperado = append(esperado, "TICKET"...)
+	esperado = append(esperado, plantillas.FF)
+	assert.True(t, bytes.HasSuffix(bin, esperado))
+	bin, _, err = plantillas.GenerateEscPos("{page 8 16 200 100}{page-dir 270}", plantillas.EPSON)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(bin, []byte{plantillas.ESC, 'W', 8, 0, 16, 0, 200, 0, 100, 0, plantillas.ESC, 'T', 1}))
+	// Sin modo página se deja sin procesar
+	bin, _, err = plantillas.GenerateEscPos("{page 576 300}{pos 10 20}", plantillas.SEIKO)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "{page 576 300}{pos 10 20}")
+}
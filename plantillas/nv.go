@@ -0,0 +1,85 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Gráficos NV: logos guardados en la memoria no volátil de la impresora (EPSON GS ( L).
+// Se graban una vez con UploadNVImage y se imprimen desde la plantilla con {nv-img KC},
+// evitando enviar la imagen en cada ticket. La memoria NV tiene un número limitado de
+// escrituras, por lo que no se deben grabar en cada impresión.
+
+var reNvImgEscPos = regexp.MustCompile(`{nv-img ([\x20-\x7a\x7c\x7e]{2})}`)
+
+// Comprueba una clave de gráfico NV: dos caracteres ASCII imprimibles
+func claveNV(key string) (kc1, kc2 byte, err error) {
+	if len(key) != 2 || key[0] < 0x20 || key[0] > 0x7e || key[1] < 0x20 || key[1] > 0x7e {
+		return 0, 0, fmt.Errorf("clave de gráfico NV %q no válida, se requieren dos caracteres ASCII", key)
+	}
+	return key[0], key[1], nil
+}
+
+// Genera la secuencia esc/pos que graba una imagen en la memoria NV de la impresora (EPSON GS ( L función 67).
+// El parámetro img tiene el mismo formato que el comando {img}, p.e. "logo.png mode=floyd", y se ajusta a un ancho
+// imprimible de puntos (0 sin límite). La imagen se imprime después desde la plantilla con {nv-img KC}.
+func GenerateNVImage(key, img string, puntos int) ([]byte, error) {
+	kc1, kc2, err := claveNV(key)
+	if err != nil {
+		return nil, err
+	}
+	raster, width, height, err := rasterizeImg(img, puntos)
+	if err != nil {
+		return nil, err
+	}
+	// m fn a kc1 kc2 b xL xH yL yH c
+	params := []byte{48, 67, 48, kc1, kc2, 1, byte(width), byte(width >> 8), byte(height), byte(height >> 8), 49}
+	z := len(params) + len(raster)
+	var datos []byte
+	if z <= 0xffff {
+		datos = []byte{GS, '(', 'L', byte(z), byte(z >> 8)} // GS ( L pL pH
+	} else {
+		datos = []byte{GS, '8', 'L', byte(z), byte(z >> 8), byte(z >> 16), byte(z >> 24)} // GS 8 L p1 p2 p3 p4
+	}
+	datos = append(datos, params...)
+	datos = append(datos, raster...)
+	return datos, nil
+}
+
+// Secuencia esc/pos que borra un gráfico NV (EPSON GS ( L función 66)
+func deleteNVImage(key string) ([]byte, error) {
+	kc1, kc2, err := claveNV(key)
+	if err != nil {
+		return nil, err
+	}
+	return []byte{GS, '(', 'L', 4, 0, 48, 66, kc1, kc2}, nil
+}
+
+// Graba una imagen en la memoria NV de la impresora, ver GenerateNVImage
+func (p *EscPosPrinter) UploadNVImage(key, img string, puntos int) error {
+	bin, err := GenerateNVImage(key, img, puntos)
+	if err != nil {
+		return err
+	}
+	_, err = p.Write(bin)
+	return err
+}
+
+// Borra un gráfico de la memoria NV de la impresora
+func (p *EscPosPrinter) DeleteNVImage(key string) error {
+	bin, err := deleteNVImage(key)
+	if err != nil {
+		return err
+	}
+	_, err = p.Write(bin)
+	return err
+}
+
+// Procesa los comandos {nv-img KC} (EPSON GS ( L función 69)
+func processEpsonNvImg(escpos []byte) []byte {
+	return reNvImgEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
+		submatches := reNvImgEscPos.FindSubmatch(match)
+		return []byte{GS, '(', 'L', 6, 0, 48, 69, submatches[1][0], submatches[1][1], 1, 1} // GS ( L pL pH m fn kc1 kc2 x y
+	})
+}
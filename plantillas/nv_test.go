@@ -0,0 +1,60 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateNVImage(t *testing.T) {
+	fn := imagenGris(t, 100, 50, 0)
+	bin, err := plantillas.GenerateNVImage("LG", fn+" width=64", 0)
+	assert.NoError(t, err)
+	// GS ( L pL pH m fn a kc1 kc2 b xL xH yL yH c
+	z := 11 + 64/8*32
+	assert.Equal(t, []byte{plantillas.GS, '(', 'L', byte(z), byte(z >> 8), 48, 67, 48, 'L', 'G', 1, 64, 0, 32, 0, 49}, bin[:16])
+	assert.Len(t, bin, 5+z)
+	_, err = plantillas.GenerateNVImage("LOGO", fn, 0)
+	assert.Error(t, err)
+}
+
+func TestNvImgEscPos(t *testing.T) {
+	impresion := []byte{plantillas.GS, '(', 'L', 6, 0, 48, 69, 'L', 'G', 1, 1}
+	bin, _, err := plantillas.GenerateEscPos("{c}{nv-img LG}", plantillas.EPSON)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Contains(bin, impresion))
+	// Sin soporte de gráficos NV se deja sin procesar
+	bin, _, err = plantillas.GenerateEscPos("{nv-img LG}", plantillas.SEIKO)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "{nv-img LG}")
+}
+
+func TestNvImgTruncada(t *testing.T) {
+	// Definición de 64x32 con un solo byte de datos: la impresión posterior muestra la marca [NV LG]
+	bin := []byte{plantillas.GS, '(', 'L', 12, 0, 48, 67, 48, 'L', 'G', 1, 64, 0, 32, 0, 49, 0xff}
+	bin = append(bin, plantillas.GS, '(', 'L', 6, 0, 48, 69, 'L', 'G', 1, 1)
+	var html bytes.Buffer
+	err := plantillas.WriteEscPosHTMLFragment(&html, 0, bin)
+	assert.NoError(t, err)
+	assert.Contains(t, html.String(), "[NV LG]")
+}
+
+func TestUploadNVImage(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address, recibido := impresoraFalsa(t, ln)
+	fn := imagenGris(t, 16, 8, 0)
+	p, err := plantillas.DialEscPos(address, time.Second)
+	assert.NoError(t, err)
+	assert.NoError(t, p.UploadNVImage("LG", fn, 0))
+	assert.NoError(t, p.DeleteNVImage("LG"))
+	assert.Error(t, p.DeleteNVImage("L"))
+	assert.NoError(t, p.Close())
+	datos := <-recibido
+	assert.Equal(t, []byte{plantillas.GS, '(', 'L', 11 + 2*8, 0, 48, 67}, datos[:7])
+	assert.Equal(t, []byte{plantillas.GS, '(', 'L', 4, 0, 48, 66, 'L', 'G'}, datos[len(datos)-9:])
+}
@@ -0,0 +1,116 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/horus-es/go-util/v3/misc"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Página de códigos de la impresora, ver GenerateEscPosCodePage
+type CodePage int
+
+// Páginas de códigos soportadas
+const (
+	CP437  CodePage = 437  // USA, Europa estándar
+	CP850  CodePage = 850  // Multilingüe
+	CP852  CodePage = 852  // Latin 2 (Europa del Este)
+	CP858  CodePage = 858  // Multilingüe con €
+	CP860  CodePage = 860  // Portugués
+	CP863  CodePage = 863  // Francés canadiense
+	CP866  CodePage = 866  // Cirílico
+	CP1250 CodePage = 1250 // Windows Europa Central
+	CP1251 CodePage = 1251 // Windows Cirílico
+	CP1252 CodePage = 1252 // Windows Europa Occidental, por defecto
+	CP1253 CodePage = 1253 // Windows Griego
+	CP1254 CodePage = 1254 // Windows Turco
+	CP1257 CodePage = 1257 // Windows Báltico
+)
+
+// Página de códigos: juego de caracteres y argumento de ESC t (ESC GS t en STAR) en cada familia (-1 si no está soportada)
+type tPaginaCodigos struct {
+	charmap *charmap.Charmap
+	epson   int
+	seiko   int
+	star    int
+}
+
+var paginasCodigos = map[CodePage]tPaginaCodigos{
+	CP437:  {charmap.CodePage437, 0, 0, 1},
+	CP850:  {charmap.CodePage850, 2, 2, -1},
+	CP852:  {charmap.CodePage852, 18, -1, 5},
+	CP858:  {charmap.CodePage858, 19, -1, 4},
+	CP860:  {charmap.CodePage860, 3, 3, 6},
+	CP863:  {charmap.CodePage863, 4, 4, 8},
+	CP866:  {charmap.CodePage866, 17, -1, 10},
+	CP1250: {charmap.Windows1250, 45, -1, 33},
+	CP1251: {charmap.Windows1251, 46, -1, 34},
+	CP1252: {charmap.Windows1252, 16, 5, 32},
+	CP1253: {charmap.Windows1253, 47, -1, -1},
+	CP1254: {charmap.Windows1254, 48, -1, -1},
+	CP1257: {charmap.Windows1257, 51, -1, -1},
+}
+
+// Devuelve el argumento de ESC t de una página de códigos en una familia de impresoras
+func escT(cp CodePage, familia int) (byte, error) {
+	pagina, ok := paginasCodigos[cp]
+	if !ok {
+		return 0, fmt.Errorf("página de códigos %d no soportada", cp)
+	}
+	n := -1
+	switch familia {
+	case EPSON:
+		n = pagina.epson
+	case SEIKO:
+		n = pagina.seiko
+	case STAR:
+		n = pagina.star
+	default:
+		return 0, nil
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("página de códigos %d no soportada en la familia %d", cp, familia)
+	}
+	return byte(n), nil
+}
+
+// Devuelve la página de códigos seleccionada por ESC t n (ESC GS t n si star), o nil si n es desconocido
+func charmapEscT(n byte, star bool) *charmap.Charmap {
+	for _, pagina := range paginasCodigos {
+		if !star && (pagina.epson == int(n) || pagina.seiko == int(n)) || star && pagina.star == int(n) {
+			return pagina.charmap
+		}
+	}
+	return nil
+}
+
+// Codifica un texto UTF-8 en una página de códigos.
+// Los caracteres que no existen en la página se transliteran con misc.QuitaAcentos y, si aun así no existen, se sustituyen por '?'.
+func codificaTexto(texto string, cp CodePage) []byte {
+	cm := paginasCodigos[cp].charmap
+	result := make([]byte, 0, len(texto))
+	codifica := func(r rune) bool {
+		if r < utf8.RuneSelf {
+			result = append(result, byte(r))
+			return true
+		}
+		b, ok := cm.EncodeRune(r)
+		if ok {
+			result = append(result, b)
+		}
+		return ok
+	}
+	for _, r := range texto {
+		if codifica(r) {
+			continue
+		}
+		for _, r2 := range misc.QuitaAcentos(string(r)) {
+			if !codifica(r2) {
+				result = append(result, '?')
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,22 @@
+package plantillas_test
+
+import (
+	"testing"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateEscPosCodePage(t *testing.T) {
+	// Página 852: existen ó, ź, ő y Ł, pero no ñ ni €
+	bin, _, err := plantillas.GenerateEscPosCodePage("Łódź ő ñ €", plantillas.EPSON, plantillas.CP852)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{plantillas.ESC, '@', plantillas.FS, '.', plantillas.ESC, 't', 18, 0x9d, 0xa2, 'd', 0xab, ' ', 0x8b, ' ', 'n', ' ', '?'}, bin)
+	// Página 1252 por defecto: ź se translitera
+	bin, _, err = plantillas.GenerateEscPos("Łódź €", plantillas.SEIKO)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{plantillas.ESC, '@', plantillas.FS, '.', plantillas.ESC, 't', 5, '?', 0xf3, 'd', 'z', ' ', 0x80}, bin)
+	// Página no soportada en SEIKO
+	_, _, err = plantillas.GenerateEscPosCodePage("x", plantillas.SEIKO, plantillas.CP1250)
+	assert.Error(t, err)
+}
@@ -0,0 +1,225 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Renderizado nativo de tickets esc/pos en PDF, sin dependencias externas, con la fuente Courier:
+// cada etiqueta es una página del ancho del papel y del alto de su contenido.
+
+// Genera un fichero PDF a partir de un []byte esc/pos (binario), sin dependencias externas.
+// Parámetro width: ancho del papel en mm.
+// Por compatibilidad, si se indican opciones se usa wkhtmltopdf con esas opciones, ver GenerateEscPosPdfWkhtml.
+func GenerateEscPosPdf(escpos []byte, out string, width int, opciones ...string) error {
+	if len(opciones) > 0 {
+		return GenerateEscPosPdfWkhtml(escpos, out, width, opciones...)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	err = WriteEscPosPdf(f, escpos, width)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Escribe en formato PDF un []byte esc/pos (binario).
+// Parámetro width: ancho del papel en mm, 80 si es 0.
+func WriteEscPosPdf(w io.Writer, escpos []byte, width int) error {
+	if width <= 0 {
+		width = 80
+	}
+	_, err := w.Write(escribePdf(maquetaEscPos(escpos, width), width))
+	return err
+}
+
+// Contenido PDF de una etiqueta, en puntos de impresora, y sus imágenes (/Im1, /Im2...)
+func contenidoPdf(et *tEtiquetaRender) (contenido []byte, imagenes []*image.Gray) {
+	var c bytes.Buffer
+	for _, o := range et.ops {
+		switch o.tipo {
+		case opRects:
+			for _, r := range o.rects {
+				fmt.Fprintf(&c, "%d %d %d %d re\n", r.Min.X, r.Min.Y, r.Dx(), r.Dy())
+			}
+			c.WriteString("f\n")
+		case opTexto:
+			textoPdf(&c, o)
+		case opImagen:
+			imagenes = append(imagenes, o.imagen)
+			w, h := o.imagen.Rect.Dx(), o.imagen.Rect.Dy()
+			fmt.Fprintf(&c, "q %d 0 0 %d %d %d cm /Im%d Do Q\n", w, -h, o.x, o.y+h, len(imagenes))
+		case opTransforma:
+			m := o.matriz
+			fmt.Fprintf(&c, "q %s %s %s %s %s %s cm\n", num(m[0]), num(m[1]), num(m[2]), num(m[3]), num(m[4]), num(m[5]))
+		case opRestaura:
+			c.WriteString("Q\n")
+		}
+	}
+	return c.Bytes(), imagenes
+}
+
+// Dibuja un trozo de texto
+func textoPdf(c *bytes.Buffer, o tOperacion) {
+	t := o.trozo
+	tam, sx, sy, base := metricaTexto(t.estilo, o.y, o.alto)
+	tam *= float64(sy)
+	escala := 100 * float64(sx) / float64(sy)
+	if t.estilo.Inverso {
+		fmt.Fprintf(c, "0 g %d %d %d %d re f 1 g\n", o.x, o.y, o.w, o.alto)
+	}
+	if t.estilo.Subrayado {
+		y := base + 2
+		if t.estilo.Invertido {
+			y = float64(2*o.y+o.alto) - y - 2
+		}
+		fmt.Fprintf(c, "%d %s %d 2 re f\n", o.x, num(y), o.w)
+	}
+	fuente := "F1"
+	if t.estilo.Negrita {
+		fuente = "F2"
+	}
+	// Espaciado entre caracteres, en unidades de texto sin la escala horizontal
+	espaciado, fin := "", ""
+	if t.estilo.Espaciado > 0 {
+		espaciado = fmt.Sprintf("%d Tc ", t.estilo.Espaciado*sy)
+		fin = " 0 Tc"
+	}
+	if t.estilo.Invertido {
+		fmt.Fprintf(c, "BT /%s %s Tf %s Tz %s-1 0 0 1 %d %s Tm %s Tj%s ET\n", fuente, num(tam), num(escala), espaciado, o.x+o.w, num(float64(2*o.y+o.alto)-base), cadenaPdf(t.texto), fin)
+	} else {
+		fmt.Fprintf(c, "BT /%s %s Tf %s Tz %s1 0 0 -1 %d %s Tm %s Tj%s ET\n", fuente, num(tam), num(escala), espaciado, o.x, num(base), cadenaPdf(t.texto), fin)
+	}
+	if t.estilo.Inverso {
+		c.WriteString("0 g\n")
+	}
+}
+
+// Codifica un texto como cadena PDF en Windows-1252 (WinAnsiEncoding)
+func cadenaPdf(texto []rune) string {
+	var s strings.Builder
+	s.WriteByte('(')
+	for _, c := range texto {
+		b, ok := charmap.Windows1252.EncodeRune(c)
+		if !ok {
+			b = '?'
+		}
+		switch {
+		case b == '(' || b == ')' || b == '\\':
+			s.WriteByte('\\')
+			s.WriteByte(b)
+		case b < 32:
+			fmt.Fprintf(&s, "\\%03o", b)
+		default:
+			s.WriteByte(b)
+		}
+	}
+	s.WriteByte(')')
+	return s.String()
+}
+
+// Formatea un número para el PDF
+func num(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Documento PDF mínimo: objetos numerados y tabla de referencias cruzadas
+type tPdf struct {
+	buf     bytes.Buffer
+	offsets []int
+}
+
+// Reserva un número de objeto
+func (p *tPdf) reserva() int {
+	p.offsets = append(p.offsets, 0)
+	return len(p.offsets)
+}
+
+// Escribe un objeto reservado
+func (p *tPdf) objeto(id int, contenido string) {
+	p.offsets[id-1] = p.buf.Len()
+	fmt.Fprintf(&p.buf, "%d 0 obj\n%s\nendobj\n", id, contenido)
+}
+
+// Escribe un objeto stream reservado, comprimido
+func (p *tPdf) stream(id int, diccionario string, datos []byte) {
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write(datos)
+	zw.Close()
+	p.offsets[id-1] = p.buf.Len()
+	diccionario = strings.TrimSpace(diccionario + " /Filter /FlateDecode /Length " + strconv.Itoa(z.Len()))
+	fmt.Fprintf(&p.buf, "%d 0 obj\n<< %s >>\nstream\n", id, diccionario)
+	p.buf.Write(z.Bytes())
+	p.buf.WriteString("\nendstream\nendobj\n")
+}
+
+// Genera el documento PDF con una página por etiqueta
+func escribePdf(etiquetas []*tEtiquetaRender, width int) []byte {
+	p := &tPdf{}
+	p.buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	catalogo := p.reserva()
+	paginas := p.reserva()
+	f1 := p.reserva()
+	f2 := p.reserva()
+	p.objeto(catalogo, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", paginas))
+	p.objeto(f1, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	p.objeto(f2, "<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	escala := 72 / 25.4 / pdfPuntosMm // puntos PDF por punto de impresora
+	margen := (width*pdfPuntosMm - puntosPapel(width)) / 2
+	anchoPt := float64(width*pdfPuntosMm) * escala
+	var kids []string
+	for _, et := range etiquetas {
+		altoPt := float64(et.alto+2*pdfMargen) * escala
+		ops, imagenes := contenidoPdf(et)
+		var xobjects strings.Builder
+		for k, img := range imagenes {
+			id := p.reserva()
+			p.stream(id, fmt.Sprintf("/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 1", img.Rect.Dx(), img.Rect.Dy()), bitsImagen(img))
+			fmt.Fprintf(&xobjects, " /Im%d %d 0 R", k+1, id)
+		}
+		contenido := p.reserva()
+		cabecera := fmt.Sprintf("%s 0 0 %s %s %s cm 0 g\n", num(escala), num(-escala), num(float64(margen)*escala), num(altoPt-float64(pdfMargen)*escala))
+		p.stream(contenido, "", append([]byte(cabecera), ops...))
+		pagina := p.reserva()
+		p.objeto(pagina, fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 %d 0 R /F2 %d 0 R >> /XObject <<%s >> >> /Contents %d 0 R >>",
+			paginas, num(anchoPt), num(altoPt), f1, f2, xobjects.String(), contenido))
+		kids = append(kids, fmt.Sprintf("%d 0 R", pagina))
+	}
+	p.objeto(paginas, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	xref := p.buf.Len()
+	fmt.Fprintf(&p.buf, "xref\n0 %d\n0000000000 65535 f \n", len(p.offsets)+1)
+	for _, o := range p.offsets {
+		fmt.Fprintf(&p.buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&p.buf, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(p.offsets)+1, catalogo, xref)
+	return p.buf.Bytes()
+}
+
+// Empaqueta una imagen en blanco y negro, un bit por pixel (1 blanco)
+func bitsImagen(img *image.Gray) []byte {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	fila := (w + 7) / 8
+	datos := make([]byte, fila*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if img.GrayAt(img.Rect.Min.X+x, img.Rect.Min.Y+y).Y >= 128 {
+				datos[y*fila+x/8] |= 128 >> (x % 8)
+			}
+		}
+	}
+	return datos
+}
@@ -0,0 +1,101 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+// Comprueba la estructura de un PDF y devuelve el número de páginas y el contenido descomprimido
+func leePdf(t *testing.T, pdf []byte) (paginas int, contenido string) {
+	assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+	assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+	// Tabla de referencias cruzadas
+	m := regexp.MustCompile(`startxref\n([0-9]+)\n`).FindSubmatch(pdf)
+	if !assert.NotNil(t, m) {
+		return
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	assert.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+	for k, o := range regexp.MustCompile(`([0-9]{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1) {
+		offset, _ := strconv.Atoi(string(o[1]))
+		assert.True(t, bytes.HasPrefix(pdf[offset:], []byte(strconv.Itoa(k+1)+" 0 obj\n")), "objeto %d", k+1)
+	}
+	paginas = bytes.Count(pdf, []byte("/Type /Page "))
+	// Streams de contenido
+	var buf bytes.Buffer
+	reStream := regexp.MustCompile(`(?s)<< /Filter /FlateDecode /Length ([0-9]+) >>\nstream\n`)
+	for _, s := range reStream.FindAllSubmatchIndex(pdf, -1) {
+		n, _ := strconv.Atoi(string(pdf[s[2]:s[3]]))
+		z, err := zlib.NewReader(bytes.NewReader(pdf[s[1] : s[1]+n]))
+		if assert.NoError(t, err) {
+			io.Copy(&buf, z)
+		}
+	}
+	return paginas, buf.String()
+}
+
+func TestWriteEscPosPdf(t *testing.T) {
+	plantilla, err := os.ReadFile("plantilla.escpos")
+	errores.PanicIfError(err)
+	f, err := plantillas.MergeEscPosTemplate("escpos", string(plantilla), factura, "/assets", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	for _, familia := range []int{plantillas.EPSON, plantillas.SEIKO, plantillas.STAR} {
+		prn, mm, err := plantillas.GenerateEscPos(f, familia)
+		errores.PanicIfError(err)
+		var pdf bytes.Buffer
+		err = plantillas.WriteEscPosPdf(&pdf, prn, mm)
+		assert.NoError(t, err)
+		paginas, contenido := leePdf(t, pdf.Bytes())
+		assert.Equal(t, 2, paginas, familia)
+		assert.Contains(t, contenido, "(C.C SEXTA AVENIDA)", familia)
+		assert.Contains(t, contenido, "/Im1 Do", familia)
+	}
+}
+
+func TestWriteEscPosPdfEtiquetas(t *testing.T) {
+	prn, mm, err := plantillas.GenerateEscPos("{paper-width 58}{b}(1)\\\n{full-cut}{r}{u}Etiqueta 2 ñ\n{bc-height 40}{code128 1234}\n{qr ABC}\n{page 200 100}{page-dir 90}{pos 10 20}Hola{end-page}{full-cut}", plantillas.EPSON)
+	errores.PanicIfError(err)
+	var pdf bytes.Buffer
+	err = plantillas.WriteEscPosPdf(&pdf, prn, mm)
+	assert.NoError(t, err)
+	paginas, contenido := leePdf(t, pdf.Bytes())
+	assert.Equal(t, 2, paginas)
+	assert.Contains(t, contenido, "/F2 20 Tf 100 Tz 1 0 0 -1 0 20 Tm (\\(1\\)\\\\) Tj")
+	assert.Contains(t, contenido, "(Etiqueta 2 \xf1)")
+	assert.Contains(t, contenido, " re\nf\n")
+	assert.Contains(t, contenido, "q 0 1 -1 0 200 ")
+	assert.Contains(t, contenido, "(Hola)")
+}
+
+func TestWriteEscPosPdfSubrayadoInvertido(t *testing.T) {
+	subrayado := func(plantilla string) float64 {
+		prn, mm, err := plantillas.GenerateEscPos(plantilla, plantillas.EPSON)
+		errores.PanicIfError(err)
+		var pdf bytes.Buffer
+		err = plantillas.WriteEscPosPdf(&pdf, prn, mm)
+		assert.NoError(t, err)
+		_, contenido := leePdf(t, pdf.Bytes())
+		m := regexp.MustCompile(`\n0 ([0-9.]+) [0-9]+ 2 re f\n`).FindStringSubmatch(contenido)
+		if !assert.NotNil(t, m, plantilla) {
+			return 0
+		}
+		y, _ := strconv.ParseFloat(m[1], 64)
+		return y
+	}
+	// Línea de 30 puntos: subrayado bajo el texto, o sobre él si está cabeza abajo
+	normal := subrayado("{u}Hola\n")
+	invertido := subrayado("{xu}Hola\n")
+	assert.Greater(t, normal, 15.0)
+	assert.Less(t, invertido, 15.0)
+	assert.Equal(t, 30.0-2, normal+invertido)
+}
@@ -0,0 +1,234 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Órdenes de impresión de imágenes raster
+const (
+	RASTER_GS_V     = "GS v 0"   // GS v 0 (EPSON)
+	RASTER_ESC_B    = "ESC b"    // ESC b ... ESC J 0 (SEIKO)
+	RASTER_ESC_GS_S = "ESC GS S" // ESC GS S 1 ... (STAR)
+)
+
+// Perfil de capacidades de una impresora esc/pos, ver GenerateEscPosProfile.
+// Los perfiles se pueden cargar de ficheros JSON con LoadEscPosProfile.
+type EscPosProfile struct {
+	Nombre      string     // Nombre del perfil
+	Familia     int        // Juego de órdenes: EPSON/SEIKO/STAR
+	AnchoPapel  int        // Ancho del papel en mm, si la plantilla no incluye {paper-width}
+	AnchoPuntos int        // Ancho imprimible en puntos (p.e. 576 en papel de 80mm, 384 en papel de 58mm)
+	CodePage    CodePage   // Página de códigos por defecto
+	CodePages   []CodePage // Páginas de códigos soportadas, vacío para todas las de la familia
+	Barcodes    []string   // Simbologías soportadas: code128, itf, upc-a, upc-e, ean-13, ean-8, code39, code93, codabar
+	BcModuloMin int        // Módulo mínimo de los códigos de barras
+	BcModuloMax int        // Módulo máximo de los códigos de barras
+	BcLongitud  int        // Longitud máxima de los códigos de barras
+	QR          bool       // Soporta códigos QR
+	QrModuloMax int        // Módulo máximo de los códigos QR
+	Codigos2D   []string   // Códigos 2D nativos: pdf417, datamatrix, aztec. Los demás se imprimen como imagen raster
+	Raster      string     // Orden de impresión de imágenes: RASTER_GS_V, RASTER_ESC_B, RASTER_ESC_GS_S o vacío si no soporta imágenes
+	Cortador    bool       // Tiene cortador. Si no lo tiene, se ignoran {full-cut} y {partial-cut}
+	GraficosNV  bool       // Soporta gráficos NV (GS ( L) para {nv-img}, solo EPSON
+	ModoPagina  bool       // Soporta el modo página (ESC L) para {page}, {page-dir}, {pos} y {end-page}, solo EPSON
+	Cajon       bool       // Tiene conector de cajón portamonedas para {drawer 1|2}
+	Zumbador    bool       // Tiene zumbador para {buzzer} y, solo EPSON, {beep n t}
+	Estricto    bool       // Modo estricto: la plantilla se valida antes de generarla y los problemas se devuelven como error, ver ValidateEscPos
+}
+
+// Perfiles genéricos de las familias
+var perfilEpson = EscPosProfile{
+	Nombre: "epson", Familia: EPSON, AnchoPapel: 80, AnchoPuntos: 576, CodePage: CP1252,
+	Barcodes:    []string{"code128", "itf", "upc-a", "upc-e", "ean-13", "ean-8", "code39", "code93", "codabar"},
+	BcModuloMin: 2, BcModuloMax: 6, BcLongitud: 29, QR: true, QrModuloMax: 16, Raster: RASTER_GS_V, Cortador: true,
+	Codigos2D: []string{"pdf417", "datamatrix", "aztec"}, GraficosNV: true, ModoPagina: true, Cajon: true, Zumbador: true,
+}
+var perfilSeiko = EscPosProfile{
+	Nombre: "seiko", Familia: SEIKO, AnchoPapel: 80, AnchoPuntos: 576, CodePage: CP1252,
+	Barcodes:    []string{"code128", "itf", "upc-a", "upc-e", "ean-13", "ean-8", "code39", "codabar"},
+	BcModuloMin: 2, BcModuloMax: 4, BcLongitud: 29, QR: true, QrModuloMax: 20, Raster: RASTER_ESC_B, Cortador: true,
+	Cajon: true, Zumbador: true,
+}
+
+var perfilStar = EscPosProfile{
+	Nombre: "star", Familia: STAR, AnchoPapel: 80, AnchoPuntos: 576, CodePage: CP1252,
+	Barcodes:    []string{"code128", "itf", "upc-a", "upc-e", "ean-13", "ean-8", "code39", "code93", "codabar"},
+	BcModuloMin: 2, BcModuloMax: 4, BcLongitud: 29, QR: true, QrModuloMax: 8, Raster: RASTER_ESC_GS_S, Cortador: true,
+	Cajon: true, Zumbador: true,
+}
+
+var perfilesMutex sync.RWMutex
+var perfiles = map[string]EscPosProfile{
+	"epson":    perfilEpson,
+	"epson-58": variante(perfilEpson, "epson-58", 58, 384),
+	"tm-t20":   variante(perfilEpson, "tm-t20", 80, 576),
+	"tm-t88":   variante(perfilEpson, "tm-t88", 80, 512),
+	"seiko":    perfilSeiko,
+	"np-k205":  variante(perfilSeiko, "np-k205", 80, 576),
+	"star":     perfilStar,
+	"tsp650":   variante(perfilStar, "tsp650", 80, 576),
+	"tsp100":   variante(perfilStar, "tsp100", 80, 576),
+}
+
+// Variante de un perfil con otro nombre y otro papel
+func variante(p EscPosProfile, nombre string, anchoPapel, anchoPuntos int) EscPosProfile {
+	p = p.copia()
+	p.Nombre = nombre
+	p.AnchoPapel = anchoPapel
+	p.AnchoPuntos = anchoPuntos
+	return p
+}
+
+// Devuelve un perfil predefinido o registrado con RegisterEscPosProfile.
+// Predefinidos: epson, epson-58, tm-t20, tm-t88, seiko, np-k205, star, tsp100, tsp650
+func GetEscPosProfile(nombre string) (EscPosProfile, error) {
+	perfilesMutex.RLock()
+	defer perfilesMutex.RUnlock()
+	p, ok := perfiles[strings.ToLower(nombre)]
+	if !ok {
+		return EscPosProfile{}, fmt.Errorf("perfil de impresora %q desconocido", nombre)
+	}
+	return p.copia(), nil
+}
+
+// Devuelve los nombres de los perfiles disponibles, ordenados
+func EscPosProfiles() []string {
+	perfilesMutex.RLock()
+	defer perfilesMutex.RUnlock()
+	nombres := make([]string, 0, len(perfiles))
+	for nombre := range perfiles {
+		nombres = append(nombres, nombre)
+	}
+	sort.Strings(nombres)
+	return nombres
+}
+
+// Registra un perfil para obtenerlo después con GetEscPosProfile. Si ya existe uno con el mismo nombre, lo sustituye.
+func RegisterEscPosProfile(p EscPosProfile) error {
+	err := p.Validate()
+	if err != nil {
+		return err
+	}
+	perfilesMutex.Lock()
+	defer perfilesMutex.Unlock()
+	perfiles[strings.ToLower(p.Nombre)] = p.copia()
+	return nil
+}
+
+// Carga un perfil de un fichero JSON con los campos de EscPosProfile, p.e.:
+//
+//	{"Base": "epson", "Nombre": "caja-1", "AnchoPuntos": 512, "CodePage": 858, "Cortador": false}
+//
+// El campo opcional Base indica un perfil existente del que se heredan los campos no incluidos.
+func LoadEscPosProfile(file string) (EscPosProfile, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return EscPosProfile{}, err
+	}
+	return ParseEscPosProfile(data)
+}
+
+// Decodifica un perfil en formato JSON, ver LoadEscPosProfile
+func ParseEscPosProfile(data []byte) (p EscPosProfile, err error) {
+	var base struct{ Base string }
+	err = json.Unmarshal(data, &base)
+	if err != nil {
+		return
+	}
+	if base.Base != "" {
+		p, err = GetEscPosProfile(base.Base)
+		if err != nil {
+			return
+		}
+	}
+	err = json.Unmarshal(data, &p)
+	if err != nil {
+		return
+	}
+	err = p.Validate()
+	return
+}
+
+// Comprueba la coherencia de un perfil
+func (p EscPosProfile) Validate() error {
+	if p.Nombre == "" {
+		return fmt.Errorf("perfil de impresora sin nombre")
+	}
+	if p.Familia != EPSON && p.Familia != SEIKO && p.Familia != STAR {
+		return fmt.Errorf("perfil %s: familia %d desconocida", p.Nombre, p.Familia)
+	}
+	if p.AnchoPapel <= 0 || p.AnchoPuntos <= 0 {
+		return fmt.Errorf("perfil %s: anchos de papel no válidos", p.Nombre)
+	}
+	if _, err := escT(p.CodePage, p.Familia); err != nil {
+		return fmt.Errorf("perfil %s: %w", p.Nombre, err)
+	}
+	if len(p.CodePages) > 0 && !slices.Contains(p.CodePages, p.CodePage) {
+		return fmt.Errorf("perfil %s: página de códigos %d no incluida en CodePages", p.Nombre, p.CodePage)
+	}
+	for _, bc := range p.Barcodes {
+		if !reBarcodeEscPos.MatchString("{" + bc + " 0}") {
+			return fmt.Errorf("perfil %s: código de barras %q desconocido", p.Nombre, bc)
+		}
+	}
+	if p.BcModuloMin < 1 || p.BcModuloMax < p.BcModuloMin || p.BcModuloMax > 255 || p.BcLongitud < 1 || p.BcLongitud > 255 {
+		return fmt.Errorf("perfil %s: parámetros de códigos de barras no válidos", p.Nombre)
+	}
+	if p.QR && (p.QrModuloMax < 1 || p.QrModuloMax > 255) {
+		return fmt.Errorf("perfil %s: módulo QR no válido", p.Nombre)
+	}
+	for _, c := range p.Codigos2D {
+		if !slices.Contains([]string{"pdf417", "datamatrix", "aztec"}, c) {
+			return fmt.Errorf("perfil %s: código 2D %q desconocido", p.Nombre, c)
+		}
+		if p.Familia != EPSON {
+			return fmt.Errorf("perfil %s: códigos 2D nativos solo soportados en la familia EPSON", p.Nombre)
+		}
+	}
+	if p.Raster != "" && p.Raster != RASTER_GS_V && p.Raster != RASTER_ESC_B && p.Raster != RASTER_ESC_GS_S {
+		return fmt.Errorf("perfil %s: orden raster %q desconocida", p.Nombre, p.Raster)
+	}
+	if p.GraficosNV && p.Familia != EPSON {
+		return fmt.Errorf("perfil %s: gráficos NV solo soportados en la familia EPSON", p.Nombre)
+	}
+	if p.ModoPagina && p.Familia != EPSON {
+		return fmt.Errorf("perfil %s: modo página solo soportado en la familia EPSON", p.Nombre)
+	}
+	return nil
+}
+
+// Devuelve una copia del perfil que no comparte los slices
+func (p EscPosProfile) copia() EscPosProfile {
+	p.CodePages = slices.Clone(p.CodePages)
+	p.Barcodes = slices.Clone(p.Barcodes)
+	p.Codigos2D = slices.Clone(p.Codigos2D)
+	return p
+}
+
+// Determina si el perfil soporta una simbología de código de barras. Las variantes de code128 se soportan con code128.
+func (p EscPosProfile) soportaBarcode(tipo string) bool {
+	if strings.HasPrefix(tipo, "code128") {
+		tipo = "code128"
+	}
+	return slices.Contains(p.Barcodes, tipo)
+}
+
+// Perfil genérico de una familia
+func perfilFamilia(familia int) EscPosProfile {
+	switch familia {
+	case EPSON:
+		return perfilEpson.copia()
+	case SEIKO:
+		return perfilSeiko.copia()
+	case STAR:
+		return perfilStar.copia()
+	}
+	return EscPosProfile{Familia: familia, AnchoPapel: 80, CodePage: CP1252}
+}
@@ -0,0 +1,54 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEscPosProfiles(t *testing.T) {
+	assert.Subset(t, plantillas.EscPosProfiles(), []string{"epson", "epson-58", "seiko"})
+	for _, nombre := range plantillas.EscPosProfiles() {
+		p, err := plantillas.GetEscPosProfile(nombre)
+		assert.NoError(t, err)
+		assert.NoError(t, p.Validate(), nombre)
+	}
+	_, err := plantillas.GetEscPosProfile("no-existe")
+	assert.Error(t, err)
+}
+
+func TestParseEscPosProfile(t *testing.T) {
+	p, err := plantillas.ParseEscPosProfile([]byte(`{"Base": "epson", "Nombre": "caja-1", "AnchoPapel": 58, "AnchoPuntos": 384, "CodePage": 858, "Barcodes": ["ean-13"], "QR": false, "Cortador": false}`))
+	assert.NoError(t, err)
+	assert.Equal(t, plantillas.EPSON, p.Familia)
+	assert.Equal(t, 6, p.BcModuloMax)
+	assert.NoError(t, plantillas.RegisterEscPosProfile(p))
+	p, err = plantillas.GetEscPosProfile("Caja-1")
+	assert.NoError(t, err)
+	bin, width, err := plantillas.GenerateEscPosProfile("{ean-13 123456789012}{code128 ABC}{qr X}{bc-modulo 5}€{full-cut}", p)
+	assert.NoError(t, err)
+	assert.Equal(t, 58, width)
+	esperado := []byte{plantillas.ESC, '@', plantillas.FS, '.', plantillas.ESC, 't', 19}
+	esperado = append(esperado, plantillas.GS, 'k', 67, 12)
+	esperado = append(esperado, "123456789012{code128 ABC}{qr X}"...)
+	esperado = append(esperado, plantillas.GS, 'w', 5, 0xd5)
+	assert.Equal(t, esperado, bin)
+	// Perfiles incoherentes
+	_, err = plantillas.ParseEscPosProfile([]byte(`{"Base": "seiko", "Nombre": "x", "CodePage": 1250}`))
+	assert.Error(t, err)
+	_, err = plantillas.ParseEscPosProfile([]byte(`{"Base": "epson", "Nombre": "x", "Barcodes": ["pdf"]}`))
+	assert.Error(t, err)
+	_, err = plantillas.ParseEscPosProfile([]byte(`{"Nombre": "x"}`))
+	assert.Error(t, err)
+}
+
+func TestGenerateEscPosProfileSeiko(t *testing.T) {
+	// Los límites de la familia SEIKO: módulo 2-4, sin code93
+	p, err := plantillas.GetEscPosProfile("seiko")
+	assert.NoError(t, err)
+	bin, _, err := plantillas.GenerateEscPosProfile("{bc-modulo 5}{code93 AB}", p)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(bin, []byte("{bc-modulo 5}{code93 AB}")))
+}
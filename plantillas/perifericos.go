@@ -0,0 +1,87 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Cajón portamonedas y avisos sonoros:
+//   - {drawer 1} o {drawer 2}: pulso de apertura del cajón conectado al pin 2 o al pin 5 del conector
+//     (EPSON y SEIKO: ESC p; STAR: BEL o SUB)
+//   - {beep n t}: n pitidos (1-63) de t décimas de segundo (1-255) con el zumbador interno (EPSON: ESC ( A)
+//   - {buzzer}: aviso sonoro corto (EPSON: ESC ( A; SEIKO: BEL; STAR: ESC GS BEL, zumbador externo)
+
+var reDrawerEscPos = regexp.MustCompile(`{drawer (1|2)}`)
+var reBeepEscPos = regexp.MustCompile(`{beep ([0-9]+) ([0-9]+)}`)
+var reBuzzerEscPos = regexp.MustCompile(`{buzzer}`)
+
+// Códigos de control de los periféricos
+const (
+	BEL = byte(0x07)
+	SUB = byte(0x1a)
+)
+
+// Duración de los pulsos del cajón: 50ms encendido, 500ms apagado (en unidades de 2ms)
+const (
+	pulsoCajonOn  = 25
+	pulsoCajonOff = 250
+)
+
+// Procesa los comandos del cajón y del zumbador. Los no soportados por la impresora se dejan sin procesar.
+func processEscPosPerifericos(escpos []byte, perfil EscPosProfile) []byte {
+	result := escpos
+	if perfil.Cajon {
+		result = reDrawerEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+			submatches := reDrawerEscPos.FindSubmatch(match)
+			pin := submatches[1][0] - '1'
+			if perfil.Familia == STAR {
+				if pin == 0 {
+					return []byte{BEL} // BEL
+				}
+				return []byte{SUB} // SUB
+			}
+			return []byte{ESC, 'p', pin, pulsoCajonOn, pulsoCajonOff} // ESC p m t1 t2
+		})
+	}
+	if perfil.Zumbador {
+		if perfil.Familia == EPSON {
+			result = reBeepEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+				submatches := reBeepEscPos.FindSubmatch(match)
+				n, _ := strconv.Atoi(string(submatches[1]))
+				t, _ := strconv.Atoi(string(submatches[2]))
+				if n < 1 || n > 63 || t < 1 || t > 255 {
+					return match
+				}
+				return pitidoEpson(n, t)
+			})
+		}
+		result = reBuzzerEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+			switch perfil.Familia {
+			case EPSON:
+				return pitidoEpson(1, 2)
+			case STAR:
+				return []byte{ESC, GS, BEL, 1, 20, 20} // ESC GS BEL m t1 t2 (en unidades de 20ms)
+			}
+			return []byte{BEL} // BEL
+		})
+	}
+	return result
+}
+
+// Orden EPSON de n pitidos de t décimas de segundo: ESC ( A pL pH fn a n t
+func pitidoEpson(n, t int) []byte {
+	return []byte{ESC, '(', 'A', 4, 0, 48, '1', byte(n), byte(t)}
+}
+
+// Texto del marcador de un elemento EscPosDrawer o EscPosBeep en las vistas previas
+func marcadorPeriferico(e EscPosElement) string {
+	switch {
+	case e.Tipo == EscPosDrawer:
+		return fmt.Sprintf("[CAJÓN %d]", e.Cajon)
+	case e.Duracion == 0:
+		return "[ZUMBADOR]"
+	}
+	return fmt.Sprintf("[PITIDO %d×%d,%ds]", e.Pitidos, e.Duracion/10, e.Duracion%10)
+}
@@ -0,0 +1,76 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerifericos(t *testing.T) {
+	const ESC, GS = plantillas.ESC, plantillas.GS
+	// EPSON: ESC p y ESC ( A
+	bin, _, err := plantillas.GenerateEscPos("Total\n{drawer 2}{beep 3 5}{buzzer}", plantillas.EPSON)
+	assert.NoError(t, err)
+	esperado := []byte{ESC, 'p', 1, 25, 250}                        // ESC p 1 50ms 500ms
+	esperado = append(esperado, ESC, '(', 'A', 4, 0, 48, '1', 3, 5) // 3 pitidos de 0,5s
+	esperado = append(esperado, ESC, '(', 'A', 4, 0, 48, '1', 1, 2) // Zumbador
+	assert.True(t, bytes.HasSuffix(bin, esperado))
+	// SEIKO: ESC p y BEL, sin pitidos
+	bin, _, err = plantillas.GenerateEscPos("Total\n{drawer 1}{buzzer}{beep 3 5}", plantillas.SEIKO)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(bin, []byte("\n\x1bp\x00\x19\xfa\x07{beep 3 5}")))
+	// STAR: BEL, SUB y ESC GS BEL
+	bin, _, err = plantillas.GenerateEscPos("Total\n{drawer 1}{drawer 2}{buzzer}", plantillas.STAR)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasSuffix(bin, []byte{'\n', plantillas.BEL, plantillas.SUB, ESC, GS, plantillas.BEL, 1, 20, 20}))
+	// Sin cajón ni zumbador se dejan sin procesar
+	perfil, _ := plantillas.GetEscPosProfile("epson")
+	perfil.Cajon = false
+	perfil.Zumbador = false
+	bin, _, err = plantillas.GenerateEscPosProfile("{drawer 1}{buzzer}", perfil)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "{drawer 1}{buzzer}")
+	// Fuera de rango
+	problemas := plantillas.ValidateEscPos("{beep 64 1}{drawer 3}", perfil)
+	assert.Len(t, problemas, 2)
+}
+
+func TestParseEscPosPerifericos(t *testing.T) {
+	for _, familia := range []int{plantillas.EPSON, plantillas.SEIKO, plantillas.STAR} {
+		bin, _, err := plantillas.GenerateEscPos("Hola\n{full-cut}{drawer 2}{buzzer}", familia)
+		assert.NoError(t, err)
+		var tipos []string
+		for _, e := range plantillas.ParseEscPos(bin) {
+			tipos = append(tipos, e.Tipo.String())
+			if e.Tipo == plantillas.EscPosDrawer {
+				assert.Equal(t, 2, e.Cajon, familia)
+			}
+		}
+		assert.Equal(t, []string{"text", "line-feed", "cut", "drawer", "beep"}, tipos, familia)
+	}
+	e := plantillas.ParseEscPos([]byte("\x1b(A\x04\x000135"))
+	if assert.Len(t, e, 1) {
+		assert.Equal(t, plantillas.EscPosElement{Tipo: plantillas.EscPosBeep, Pitidos: '3', Duracion: '5'}, e[0])
+	}
+}
+
+func TestVistaPreviaPerifericos(t *testing.T) {
+	bin, mm, err := plantillas.GenerateEscPos("Hola\n{beep 2 15}{full-cut}{drawer 1}", plantillas.EPSON)
+	assert.NoError(t, err)
+	// El marcador del cajón tras el corte va en la misma etiqueta
+	var pdf bytes.Buffer
+	err = plantillas.WriteEscPosPdf(&pdf, bin, mm)
+	assert.NoError(t, err)
+	paginas, contenido := leePdf(t, pdf.Bytes())
+	assert.Equal(t, 1, paginas)
+	assert.Contains(t, contenido, "([PITIDO 2\xd71,5s])")
+	assert.Contains(t, contenido, "([CAJ\xd3N 1])")
+	var html bytes.Buffer
+	err = plantillas.WriteEscPosHTMLFragment(&html, mm, bin)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(html.String(), "<escpos>"))
+	assert.Contains(t, html.String(), `<span class="marker">[CAJÓN 1]</span>`)
+}
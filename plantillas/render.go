@@ -0,0 +1,383 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"image"
+
+	"github.com/horus-es/go-util/v3/barcode"
+	go_qr "github.com/piglig/go-qr"
+)
+
+// Maquetación de tickets esc/pos para los renderizados PDF, PNG y SVG. Se trabaja en puntos de impresora
+// (8 puntos por mm) con una fuente monoespaciada, igual que la vista previa HTML: cada etiqueta (hasta un corte)
+// se convierte en una lista de operaciones de dibujo y su alto.
+
+// Métricas del renderizado, en puntos de impresora
+const (
+	pdfPuntosMm     = 8  // Puntos por mm
+	pdfAnchoNormal  = 12 // Ancho de carácter de la fuente normal
+	pdfAnchoPequeno = 9  // Ancho de carácter de la fuente pequeña
+	pdfAnchoFuenteC = 8  // Ancho de carácter de la fuente C
+	pdfInterlineado = 30 // Alto de línea
+	pdfEspaciado    = 6  // Espacio entre líneas
+	pdfAltoHRI      = 24 // Alto de línea del texto de los códigos de barras
+	pdfMargen       = 32 // Margen superior e inferior
+)
+
+// Tipos de operación de dibujo
+const (
+	opRects      = iota // Rectángulos negros
+	opTexto             // Trozo de texto
+	opImagen            // Imagen en blanco y negro
+	opTransforma        // Inicia una transformación de coordenadas (modo página)
+	opRestaura          // Termina la transformación
+)
+
+// Trozo de texto con un estilo dentro de una línea
+type tTrozo struct {
+	estilo EscPosStyle
+	texto  []rune
+}
+
+// Operación de dibujo, en puntos
+type tOperacion struct {
+	tipo   int
+	rects  []image.Rectangle // opRects
+	trozo  tTrozo            // opTexto, en el rectángulo x, y, w, alto
+	x, y   int               // opTexto, opImagen
+	w      int               // opTexto
+	alto   int               // opTexto
+	imagen *image.Gray       // opImagen
+	matriz [6]float64        // opTransforma
+}
+
+// Etiqueta maquetada
+type tEtiquetaRender struct {
+	ops   []tOperacion
+	alto  int
+	vacia bool
+}
+
+// Estado de la maquetación
+type tMaqueta struct {
+	puntos    int // Ancho imprimible
+	etiquetas []*tEtiquetaRender
+	et        *tEtiquetaRender
+	linea     []tTrozo
+	anchoLin  int
+	x0, y     int // Origen de las líneas y posición vertical en curso
+	ancho     int // Ancho disponible para las líneas
+	// Interlineado, margen izquierdo y ancho de impresión (EscPosLayout)
+	interlineado int
+	margen       int
+	anchoImp     int
+	// Modo página
+	enPagina bool
+	yPagina  int
+	hPagina  int
+}
+
+// Maqueta un []byte esc/pos (binario) en un papel de width mm, 80 si es 0. Devuelve al menos una etiqueta.
+func maquetaEscPos(escpos []byte, width int) []*tEtiquetaRender {
+	if width <= 0 {
+		width = 80
+	}
+	m := &tMaqueta{puntos: puntosPapel(width), interlineado: pdfInterlineado}
+	m.nuevaEtiqueta()
+	for _, e := range ParseEscPos(escpos) {
+		m.elemento(e)
+	}
+	m.cierraEtiqueta()
+	if len(m.etiquetas) == 0 {
+		m.etiquetas = append(m.etiquetas, m.et)
+	}
+	return m.etiquetas
+}
+
+// Añade una operación a la etiqueta en curso
+func (m *tMaqueta) op(o tOperacion) {
+	m.et.ops = append(m.et.ops, o)
+}
+
+// Inicia una etiqueta
+func (m *tMaqueta) nuevaEtiqueta() {
+	m.et = &tEtiquetaRender{vacia: true}
+	m.linea = nil
+	m.anchoLin = 0
+	m.y = 0
+	m.area()
+	m.enPagina = false
+}
+
+// Ajusta el origen y el ancho de las líneas al margen y al ancho de impresión
+func (m *tMaqueta) area() {
+	m.x0 = min(m.margen, m.puntos-pdfAnchoNormal)
+	m.ancho = m.puntos - m.x0
+	if m.anchoImp > 0 {
+		m.ancho = min(m.ancho, max(m.anchoImp, pdfAnchoNormal))
+	}
+}
+
+// Termina la etiqueta en curso, si tiene contenido
+func (m *tMaqueta) cierraEtiqueta() {
+	m.cierraLinea(false)
+	if m.enPagina {
+		m.finPagina()
+	}
+	if !m.et.vacia {
+		m.et.alto = m.y
+		m.etiquetas = append(m.etiquetas, m.et)
+	}
+	m.nuevaEtiqueta()
+}
+
+// Procesa un elemento decodificado
+func (m *tMaqueta) elemento(e EscPosElement) {
+	if e.Tipo == EscPosDrawer || e.Tipo == EscPosBeep {
+		m.marcador(marcadorPeriferico(e))
+		return
+	}
+	if e.Tipo == EscPosLayout {
+		m.interlineado = pdfInterlineado
+		if e.Interlineado > 0 {
+			m.interlineado = e.Interlineado
+		}
+		m.margen, m.anchoImp = e.X, e.Ancho
+		if !m.enPagina && len(m.linea) == 0 {
+			m.area()
+		}
+		return
+	}
+	if e.Tipo != EscPosCut {
+		m.et.vacia = false
+	}
+	switch e.Tipo {
+	case EscPosText:
+		for _, c := range e.Texto {
+			w := anchoCaracter(e.Estilo)
+			if m.anchoLin+w > m.ancho && len(m.linea) > 0 {
+				m.cierraLinea(false)
+			}
+			if n := len(m.linea); n > 0 && m.linea[n-1].estilo == e.Estilo {
+				m.linea[n-1].texto = append(m.linea[n-1].texto, c)
+			} else {
+				m.linea = append(m.linea, tTrozo{estilo: e.Estilo, texto: []rune{c}})
+			}
+			m.anchoLin += w
+		}
+	case EscPosLineFeed:
+		m.cierraLinea(true)
+	case EscPosImage:
+		m.cierraLinea(false)
+		w, h := e.Imagen.Rect.Dx(), e.Imagen.Rect.Dy()
+		if w > 0 && h > 0 {
+			m.op(tOperacion{tipo: opImagen, imagen: e.Imagen, x: m.alinea(e.Estilo.Alineacion, w), y: m.y})
+		}
+		m.y += h
+	case EscPosBarcode:
+		m.cierraLinea(false)
+		m.barcode(e)
+	case EscPosQR:
+		m.cierraLinea(false)
+		m.qr(e)
+	case EscPosCut:
+		m.cierraEtiqueta()
+	case EscPosPageStart:
+		m.cierraLinea(false)
+		m.enPagina = true
+		m.yPagina = m.y + e.Y
+		m.hPagina = e.Alto
+		// Transformación al sistema de coordenadas de la dirección de escritura
+		ox, oy, w, h := float64(e.X), float64(m.yPagina), float64(e.Ancho), float64(e.Alto)
+		anchoInterior := e.Ancho
+		var matriz [6]float64
+		switch e.Direccion {
+		case 1:
+			matriz = [6]float64{0, -1, 1, 0, ox, oy + h}
+			anchoInterior = e.Alto
+		case 2:
+			matriz = [6]float64{-1, 0, 0, -1, ox + w, oy + h}
+		case 3:
+			matriz = [6]float64{0, 1, -1, 0, ox + w, oy}
+			anchoInterior = e.Alto
+		default:
+			matriz = [6]float64{1, 0, 0, 1, ox, oy}
+		}
+		m.op(tOperacion{tipo: opTransforma, matriz: matriz})
+		m.x0, m.y, m.ancho = 0, 0, anchoInterior
+	case EscPosPosition:
+		m.cierraLinea(false)
+		m.x0, m.y = e.X, e.Y
+	case EscPosPageEnd:
+		m.finPagina()
+	}
+}
+
+// Dibuja el marcador de una orden sin representación impresa (cajón, zumbador) en una línea propia. Tras un corte,
+// se añade al final de la etiqueta anterior.
+func (m *tMaqueta) marcador(texto string) {
+	m.cierraLinea(false)
+	if n := len(m.etiquetas); m.et.vacia && n > 0 {
+		m.et = m.etiquetas[n-1]
+		m.etiquetas = m.etiquetas[:n-1]
+		m.y = m.et.alto
+	}
+	m.et.vacia = false
+	estilo := EscPosStyle{Alineacion: "center", Pequeno: true, Inverso: true}
+	runas := []rune(texto)
+	m.linea = []tTrozo{{estilo: estilo, texto: runas}}
+	m.anchoLin = anchoCaracter(estilo) * len(runas)
+	m.cierraLinea(false)
+}
+
+// Termina el modo página
+func (m *tMaqueta) finPagina() {
+	m.cierraLinea(false)
+	m.op(tOperacion{tipo: opRestaura})
+	m.enPagina = false
+	m.area()
+	m.y = m.yPagina + m.hPagina
+}
+
+// Posición horizontal de un elemento alineado. En modo página se alinea a la izquierda de la posición.
+func (m *tMaqueta) alinea(alineacion string, w int) int {
+	if m.enPagina {
+		return m.x0
+	}
+	switch alineacion {
+	case "center":
+		return m.x0 + max(m.ancho-w, 0)/2
+	case "right":
+		return m.x0 + max(m.ancho-w, 0)
+	}
+	return m.x0
+}
+
+// Ancho de los glifos de la fuente de un estilo, sin doble ancho ni espaciado
+func anchoFuente(estilo EscPosStyle) int {
+	switch {
+	case estilo.FuenteC:
+		return pdfAnchoFuenteC
+	case estilo.Pequeno:
+		return pdfAnchoPequeno
+	}
+	return pdfAnchoNormal
+}
+
+// Ancho de un carácter con un estilo, incluido el espaciado
+func anchoCaracter(estilo EscPosStyle) int {
+	w := anchoFuente(estilo) + estilo.Espaciado
+	if estilo.DobleAncho {
+		w *= 2
+	}
+	return w
+}
+
+// Métricas de un trozo de texto en una línea que empieza en y: tamaño de la fuente sin escalar (con un ancho
+// de carácter de 0.6 em), escalas horizontal y vertical y línea base
+func metricaTexto(estilo EscPosStyle, y, alto int) (tam float64, sx, sy int, base float64) {
+	tam = float64(anchoFuente(estilo)) / 0.6
+	sx, sy = 1, 1
+	if estilo.DobleAncho {
+		sx = 2
+	}
+	if estilo.DobleAlto {
+		sy = 2
+	}
+	base = float64(y+alto-pdfEspaciado) - 0.2*tam*float64(sy)
+	return
+}
+
+// Dibuja la línea en curso. Si está vacía y salto es true, avanza una línea en blanco.
+// El alto de la línea es el interlineado, aumentado con los caracteres de doble alto.
+func (m *tMaqueta) cierraLinea(salto bool) {
+	if len(m.linea) == 0 {
+		if salto {
+			m.y += m.interlineado
+		}
+		if !m.enPagina {
+			m.area()
+		}
+		return
+	}
+	altoTexto := pdfInterlineado - pdfEspaciado
+	for _, t := range m.linea {
+		if t.estilo.DobleAlto {
+			altoTexto = 2 * (pdfInterlineado - pdfEspaciado)
+		}
+	}
+	alto := max(m.interlineado+altoTexto-(pdfInterlineado-pdfEspaciado), altoTexto)
+	x := m.alinea(m.linea[0].estilo.Alineacion, m.anchoLin)
+	for _, t := range m.linea {
+		w := anchoCaracter(t.estilo) * len(t.texto)
+		m.op(tOperacion{tipo: opTexto, trozo: t, x: x, y: m.y, w: w, alto: alto})
+		x += w
+	}
+	m.y += alto
+	m.linea = nil
+	m.anchoLin = 0
+	if !m.enPagina {
+		m.area()
+	}
+}
+
+// Dibuja un código de barras con su texto
+func (m *tMaqueta) barcode(e EscPosElement) {
+	barras, hri, err := barcode.GetBarcodeBARS(e.Texto, e.Simbologia)
+	if err != nil {
+		return
+	}
+	modulo := max(e.Modulo, 1)
+	w := 0
+	for _, b := range barras {
+		w += int(b-'0') * modulo
+	}
+	x := m.alinea(e.Estilo.Alineacion, w)
+	texto := func() {
+		runas := []rune(hri)
+		tx := x + (w-pdfAnchoPequeno*len(runas))/2
+		m.op(tOperacion{tipo: opTexto, trozo: tTrozo{estilo: EscPosStyle{Pequeno: true}, texto: runas}, x: tx, y: m.y, w: pdfAnchoPequeno * len(runas), alto: pdfAltoHRI})
+		m.y += pdfAltoHRI
+	}
+	if e.HRI == barcode.Above || e.HRI == barcode.Both {
+		texto()
+	}
+	var rects []image.Rectangle
+	negro := true
+	bx := x
+	for _, b := range barras {
+		bw := int(b-'0') * modulo
+		if negro {
+			rects = append(rects, image.Rect(bx, m.y, bx+bw, m.y+e.Altura))
+		}
+		bx += bw
+		negro = !negro
+	}
+	m.op(tOperacion{tipo: opRects, rects: rects})
+	m.y += e.Altura
+	if e.HRI == barcode.Below || e.HRI == barcode.Both {
+		texto()
+	}
+}
+
+// Dibuja un código QR
+func (m *tMaqueta) qr(e EscPosElement) {
+	qr, err := go_qr.EncodeBinary(e.Datos, go_qr.Ecc(e.ECC))
+	if err != nil {
+		return
+	}
+	modulo := max(e.Modulo, 1)
+	n := qr.Size()
+	x := m.alinea(e.Estilo.Alineacion, n*modulo)
+	var rects []image.Rectangle
+	for qy := range n {
+		for qx := range n {
+			if qr.Module(qx, qy) {
+				rx, ry := x+qx*modulo, m.y+qy*modulo
+				rects = append(rects, image.Rect(rx, ry, rx+modulo, ry+modulo))
+			}
+		}
+	}
+	m.op(tOperacion{tipo: opRects, rects: rects})
+	m.y += n * modulo
+}
@@ -0,0 +1,322 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cola de impresión: los trabajos de cada impresora se imprimen de uno en uno y en orden de llegada, aunque se
+// encolen desde varias goroutines. Si la impresora no responde, el trabajo se reintenta con espera exponencial sin
+// pasar al siguiente. Si el envío falla a medias, el trabajo termina FALLIDO, para no imprimir el documento duplicado.
+// Con un directorio de persistencia, los trabajos pendientes se graban en disco y se recuperan al crear de nuevo la cola.
+
+// Estados de los trabajos de impresión
+const (
+	SPOOL_EN_COLA     = "EN_COLA"     // Pendiente de impresión o de reintento
+	SPOOL_IMPRIMIENDO = "IMPRIMIENDO" // Enviándose a la impresora
+	SPOOL_IMPRESO     = "IMPRESO"     // Enviado correctamente
+	SPOOL_FALLIDO     = "FALLIDO"     // Envío interrumpido o reintentos agotados
+)
+
+// Trabajo de impresión
+type EscPosJob struct {
+	ID        string    // Identificador único
+	Impresora string    // Dirección de la impresora, ver DialEscPos
+	Datos     []byte    // esc/pos binario
+	Estado    string    // SPOOL_EN_COLA, SPOOL_IMPRIMIENDO, SPOOL_IMPRESO o SPOOL_FALLIDO
+	Intentos  int       // Intentos de envío realizados
+	Error     string    // Error del último intento
+	Creado    time.Time // Fecha de encolado
+}
+
+// Configuración de la cola de impresión
+type EscPosSpoolerConfig struct {
+	Directorio  string          // Directorio de persistencia de los trabajos pendientes, vacío para no persistirlos
+	Timeout     time.Duration   // Timeout de conexión y envío, por defecto 10 segundos
+	MaxIntentos int             // Número máximo de intentos antes de pasar a FALLIDO, 0 para reintentar indefinidamente
+	Espera      time.Duration   // Espera tras el primer fallo, que se duplica en cada reintento. Por defecto 1 segundo
+	EsperaMax   time.Duration   // Espera máxima entre reintentos, por defecto 1 minuto
+	Notifica    func(EscPosJob) // Función a la que se notifican los cambios de estado en orden, opcional. EN_COLA se notifica desde Enqueue y el resto desde la goroutine de la impresora, salvo el FALLIDO de los trabajos rechazados por Close
+}
+
+// Cola de impresión, ver NewEscPosSpooler
+type EscPosSpooler struct {
+	cfg      EscPosSpoolerConfig
+	mutex    sync.Mutex
+	colas    map[string][]*EscPosJob // Trabajos pendientes por impresora, el primero es el que se está imprimiendo
+	trabajos map[string]*EscPosJob   // Trabajos pendientes por id
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// Crea una cola de impresión. Si se indica un directorio de persistencia, se crea si no existe y se reanudan los
+// trabajos pendientes grabados en él. Los que se estaban imprimiendo cuando se detuvo la cola se imprimen de nuevo.
+func NewEscPosSpooler(cfg EscPosSpoolerConfig) (*EscPosSpooler, error) {
+	s := &EscPosSpooler{cfg: spoolerPorDefecto(cfg), colas: map[string][]*EscPosJob{}, trabajos: map[string]*EscPosJob{}}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	if s.cfg.Directorio == "" {
+		return s, nil
+	}
+	err := os.MkdirAll(s.cfg.Directorio, 0777)
+	if err != nil {
+		return nil, fmt.Errorf("cola de impresión: %w", err)
+	}
+	ficheros, err := filepath.Glob(filepath.Join(s.cfg.Directorio, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("cola de impresión: %w", err)
+	}
+	var pendientes []*EscPosJob
+	for _, f := range ficheros {
+		datos, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("cola de impresión: %w", err)
+		}
+		job := &EscPosJob{}
+		err = json.Unmarshal(datos, job)
+		if err != nil {
+			return nil, fmt.Errorf("cola de impresión %s: %w", f, err)
+		}
+		job.Estado = SPOOL_EN_COLA
+		pendientes = append(pendientes, job)
+	}
+	sort.Slice(pendientes, func(i, j int) bool {
+		if !pendientes[i].Creado.Equal(pendientes[j].Creado) {
+			return pendientes[i].Creado.Before(pendientes[j].Creado)
+		}
+		return pendientes[i].ID < pendientes[j].ID
+	})
+	s.mutex.Lock()
+	var impresoras []string
+	for _, job := range pendientes {
+		if s.encola(job) {
+			impresoras = append(impresoras, job.Impresora)
+		}
+	}
+	s.mutex.Unlock()
+	for _, address := range impresoras {
+		go s.imprime(address)
+	}
+	return s, nil
+}
+
+// Valores por defecto de la configuración
+func spoolerPorDefecto(cfg EscPosSpoolerConfig) EscPosSpoolerConfig {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MaxIntentos < 0 {
+		cfg.MaxIntentos = 0
+	}
+	if cfg.Espera <= 0 {
+		cfg.Espera = time.Second
+	}
+	if cfg.EsperaMax <= 0 {
+		cfg.EsperaMax = time.Minute
+	}
+	return cfg
+}
+
+// Encola un esc/pos binario (ver GenerateEscPos) para una impresora (ver DialEscPos para los formatos de address).
+// Devuelve el id del trabajo.
+func (s *EscPosSpooler) Enqueue(address string, bin []byte) (string, error) {
+	id := make([]byte, 8)
+	rand.Read(id)
+	job := &EscPosJob{
+		ID:        fmt.Sprintf("%016x-%s", time.Now().UnixNano(), hex.EncodeToString(id)),
+		Impresora: address,
+		Datos:     bin,
+		Estado:    SPOOL_EN_COLA,
+		Creado:    time.Now(),
+	}
+	if s.ctx.Err() != nil {
+		return "", errors.New("cola de impresión cerrada")
+	}
+	err := s.graba(job)
+	if err != nil {
+		return "", err
+	}
+	// EN_COLA se notifica antes de que la goroutine de la impresora vea el trabajo, para que sea siempre su primer estado
+	s.notifica(*job)
+	s.mutex.Lock()
+	if s.ctx.Err() != nil {
+		s.mutex.Unlock()
+		if s.cfg.Directorio != "" {
+			// El trabajo queda en el directorio de persistencia para la siguiente cola
+			return job.ID, nil
+		}
+		// Ya se notificó EN_COLA: se cierra el trabajo rechazado para que no quede pendiente para siempre
+		job.Estado = SPOOL_FALLIDO
+		job.Error = "cola de impresión cerrada"
+		s.notifica(*job)
+		return "", errors.New(job.Error)
+	}
+	inicia := s.encola(job)
+	s.mutex.Unlock()
+	if inicia {
+		go s.imprime(address)
+	}
+	return job.ID, nil
+}
+
+// Devuelve el estado de un trabajo pendiente. Los trabajos terminados (IMPRESO o FALLIDO) ya no se encuentran.
+func (s *EscPosSpooler) Job(id string) (EscPosJob, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	job, ok := s.trabajos[id]
+	if !ok {
+		return EscPosJob{}, false
+	}
+	return *job, true
+}
+
+// Devuelve los trabajos pendientes de una impresora, en orden de impresión
+func (s *EscPosSpooler) Pending(address string) []EscPosJob {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	pendientes := make([]EscPosJob, len(s.colas[address]))
+	for k, job := range s.colas[address] {
+		pendientes[k] = *job
+	}
+	return pendientes
+}
+
+// Detiene la cola, esperando a que terminen los envíos en curso. Los trabajos pendientes se conservan en el
+// directorio de persistencia para la siguiente cola.
+func (s *EscPosSpooler) Close() {
+	s.mutex.Lock()
+	s.cancel()
+	s.mutex.Unlock()
+	s.wg.Wait()
+}
+
+// Añade un trabajo a la cola de su impresora. Devuelve true si hay que iniciar la goroutine de la impresora,
+// que ya se cuenta en el WaitGroup. Requiere el mutex.
+func (s *EscPosSpooler) encola(job *EscPosJob) bool {
+	s.trabajos[job.ID] = job
+	s.colas[job.Impresora] = append(s.colas[job.Impresora], job)
+	if len(s.colas[job.Impresora]) > 1 {
+		return false
+	}
+	s.wg.Add(1)
+	return true
+}
+
+// Imprime los trabajos de una impresora hasta vaciar su cola o detener la cola de impresión
+func (s *EscPosSpooler) imprime(address string) {
+	defer s.wg.Done()
+	for {
+		s.mutex.Lock()
+		if len(s.colas[address]) == 0 {
+			delete(s.colas, address)
+			s.mutex.Unlock()
+			return
+		}
+		job := s.colas[address][0]
+		s.mutex.Unlock()
+		if !s.procesa(job) {
+			return
+		}
+	}
+}
+
+// Envía un trabajo con reintentos. Devuelve false si se detiene la cola de impresión antes de terminarlo.
+func (s *EscPosSpooler) procesa(job *EscPosJob) bool {
+	espera := s.cfg.Espera
+	for {
+		if s.ctx.Err() != nil {
+			return false
+		}
+		s.cambia(job, SPOOL_IMPRIMIENDO, "", 1)
+		n, err := printEscPos(job.Impresora, job.Datos, s.cfg.Timeout)
+		switch {
+		case err == nil:
+			s.termina(job, SPOOL_IMPRESO, "")
+			return true
+		case n > 0:
+			s.termina(job, SPOOL_FALLIDO, fmt.Sprintf("envío interrumpido tras %d bytes: %s", n, err))
+			return true
+		case s.cfg.MaxIntentos > 0 && job.Intentos >= s.cfg.MaxIntentos:
+			s.termina(job, SPOOL_FALLIDO, err.Error())
+			return true
+		}
+		s.cambia(job, SPOOL_EN_COLA, err.Error(), 0)
+		select {
+		case <-s.ctx.Done():
+			return false
+		case <-time.After(espera):
+		}
+		espera = min(2*espera, s.cfg.EsperaMax)
+	}
+}
+
+// Cambia el estado de un trabajo pendiente, lo graba y lo notifica
+func (s *EscPosSpooler) cambia(job *EscPosJob, estado, mensaje string, intentos int) {
+	s.mutex.Lock()
+	job.Estado = estado
+	job.Error = mensaje
+	job.Intentos += intentos
+	s.graba(job)
+	copia := *job
+	s.mutex.Unlock()
+	s.notifica(copia)
+}
+
+// Termina un trabajo, lo quita de la cola y del directorio de persistencia y lo notifica
+func (s *EscPosSpooler) termina(job *EscPosJob, estado, mensaje string) {
+	s.mutex.Lock()
+	job.Estado = estado
+	job.Error = mensaje
+	s.colas[job.Impresora] = s.colas[job.Impresora][1:]
+	delete(s.trabajos, job.ID)
+	if s.cfg.Directorio != "" {
+		os.Remove(s.fichero(job))
+	}
+	copia := *job
+	s.mutex.Unlock()
+	s.notifica(copia)
+}
+
+// Graba un trabajo en el directorio de persistencia, de forma atómica
+func (s *EscPosSpooler) graba(job *EscPosJob) error {
+	if s.cfg.Directorio == "" {
+		return nil
+	}
+	datos, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("cola de impresión: %w", err)
+	}
+	tmp := strings.TrimSuffix(s.fichero(job), ".json") + ".tmp"
+	err = os.WriteFile(tmp, datos, 0666)
+	if err == nil {
+		err = os.Rename(tmp, s.fichero(job))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("cola de impresión: %w", err)
+	}
+	return nil
+}
+
+// Fichero de persistencia de un trabajo
+func (s *EscPosSpooler) fichero(job *EscPosJob) string {
+	return filepath.Join(s.cfg.Directorio, job.ID+".json")
+}
+
+// Notifica un cambio de estado
+func (s *EscPosSpooler) notifica(job EscPosJob) {
+	if s.cfg.Notifica != nil {
+		s.cfg.Notifica(job)
+	}
+}
@@ -0,0 +1,193 @@
+package plantillas_test
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+// Recoge las notificaciones de una cola de impresión y avisa de los trabajos terminados
+type tNotificaciones struct {
+	mutex      sync.Mutex
+	estados    map[string][]string
+	terminados chan plantillas.EscPosJob
+}
+
+func nuevasNotificaciones() *tNotificaciones {
+	return &tNotificaciones{estados: map[string][]string{}, terminados: make(chan plantillas.EscPosJob, 10)}
+}
+
+func (n *tNotificaciones) notifica(job plantillas.EscPosJob) {
+	n.mutex.Lock()
+	n.estados[job.ID] = append(n.estados[job.ID], job.Estado)
+	n.mutex.Unlock()
+	if job.Estado == plantillas.SPOOL_IMPRESO || job.Estado == plantillas.SPOOL_FALLIDO {
+		n.terminados <- job
+	}
+}
+
+func (n *tNotificaciones) estadosDe(id string) []string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return n.estados[id]
+}
+
+func (n *tNotificaciones) espera(t *testing.T) plantillas.EscPosJob {
+	select {
+	case job := <-n.terminados:
+		return job
+	case <-time.After(5 * time.Second):
+		t.Fatal("trabajo no terminado")
+	}
+	return plantillas.EscPosJob{}
+}
+
+func TestEscPosSpooler(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address, recibido := impresoraFalsa(t, ln)
+	n := nuevasNotificaciones()
+	s, err := plantillas.NewEscPosSpooler(plantillas.EscPosSpoolerConfig{Timeout: time.Second, Notifica: n.notifica})
+	assert.NoError(t, err)
+	defer s.Close()
+	// Varias goroutines imprimiendo a la vez: cada trabajo llega completo en su propia conexión
+	var wg sync.WaitGroup
+	for k := range 5 {
+		wg.Go(func() {
+			_, err := s.Enqueue(address, []byte(fmt.Sprintf("ticket %d\n", k)))
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+	tickets := map[string]bool{}
+	for range 5 {
+		job := n.espera(t)
+		assert.Equal(t, plantillas.SPOOL_IMPRESO, job.Estado)
+		assert.Equal(t, []string{plantillas.SPOOL_EN_COLA, plantillas.SPOOL_IMPRIMIENDO, plantillas.SPOOL_IMPRESO}, n.estadosDe(job.ID))
+		tickets[string(<-recibido)] = true
+	}
+	assert.Len(t, tickets, 5)
+	assert.Empty(t, s.Pending(address))
+}
+
+func TestEscPosSpoolerReintentos(t *testing.T) {
+	// Impresora apagada: los trabajos esperan en orden
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	address := ln.Addr().String()
+	ln.Close()
+	dir := t.TempDir()
+	n := nuevasNotificaciones()
+	s, err := plantillas.NewEscPosSpooler(plantillas.EscPosSpoolerConfig{Directorio: dir, Timeout: time.Second, Espera: 20 * time.Millisecond, Notifica: n.notifica})
+	assert.NoError(t, err)
+	id1, err := s.Enqueue(address, []byte("uno"))
+	assert.NoError(t, err)
+	id2, err := s.Enqueue(address, []byte("dos"))
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+	pendientes := s.Pending(address)
+	if assert.Len(t, pendientes, 2) {
+		assert.Equal(t, id1, pendientes[0].ID)
+		assert.Equal(t, id2, pendientes[1].ID)
+		assert.Greater(t, pendientes[0].Intentos, 1)
+		assert.Zero(t, pendientes[1].Intentos)
+		assert.NotEmpty(t, pendientes[0].Error)
+	}
+	// Los trabajos pendientes sobreviven a un reinicio
+	s.Close()
+	ficheros, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Len(t, ficheros, 2)
+	_, err = s.Enqueue(address, []byte("tres"))
+	assert.Error(t, err)
+	ln, err = net.Listen("tcp", address)
+	if err != nil {
+		t.Skip("puerto ocupado:", err)
+	}
+	_, recibido := impresoraFalsa(t, ln)
+	s, err = plantillas.NewEscPosSpooler(plantillas.EscPosSpoolerConfig{Directorio: dir, Timeout: time.Second, Notifica: n.notifica})
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, id1, n.espera(t).ID)
+	assert.Equal(t, id2, n.espera(t).ID)
+	assert.Equal(t, "uno", string(<-recibido))
+	assert.Equal(t, "dos", string(<-recibido))
+	ficheros, _ = filepath.Glob(filepath.Join(dir, "*"))
+	assert.Empty(t, ficheros)
+}
+
+func TestEscPosSpoolerFallido(t *testing.T) {
+	n := nuevasNotificaciones()
+	s, err := plantillas.NewEscPosSpooler(plantillas.EscPosSpoolerConfig{MaxIntentos: 2, Espera: time.Millisecond, Notifica: n.notifica})
+	assert.NoError(t, err)
+	defer s.Close()
+	id, err := s.Enqueue("/dev/no-existe", []byte("x"))
+	assert.NoError(t, err)
+	job := n.espera(t)
+	assert.Equal(t, id, job.ID)
+	assert.Equal(t, plantillas.SPOOL_FALLIDO, job.Estado)
+	assert.Equal(t, 2, job.Intentos)
+	assert.Contains(t, job.Error, "/dev/no-existe")
+	_, ok := s.Job(id)
+	assert.False(t, ok)
+	// Impresión en fichero
+	fn := filepath.Join(t.TempDir(), "ticket.prn")
+	_, err = s.Enqueue(fn, []byte("hola"))
+	assert.NoError(t, err)
+	assert.Equal(t, plantillas.SPOOL_IMPRESO, n.espera(t).Estado)
+	datos, _ := os.ReadFile(fn)
+	assert.Equal(t, "hola", string(datos))
+}
+
+func TestEscPosSpoolerOrdenNotificaciones(t *testing.T) {
+	// Un oyente lento en EN_COLA no debe ver estados posteriores antes que EN_COLA
+	n := nuevasNotificaciones()
+	notifica := func(job plantillas.EscPosJob) {
+		if job.Estado == plantillas.SPOOL_EN_COLA {
+			time.Sleep(50 * time.Millisecond)
+		}
+		n.notifica(job)
+	}
+	s, err := plantillas.NewEscPosSpooler(plantillas.EscPosSpoolerConfig{Notifica: notifica})
+	assert.NoError(t, err)
+	defer s.Close()
+	fn := filepath.Join(t.TempDir(), "ticket.prn")
+	// El primer trabajo arranca la goroutine de la impresora, que ya está en marcha al encolar el segundo
+	var ids []string
+	for _, datos := range []string{"uno", "dos"} {
+		id, err := s.Enqueue(fn, []byte(datos))
+		assert.NoError(t, err)
+		ids = append(ids, id)
+	}
+	for range ids {
+		n.espera(t)
+	}
+	for _, id := range ids {
+		assert.Equal(t, []string{plantillas.SPOOL_EN_COLA, plantillas.SPOOL_IMPRIMIENDO, plantillas.SPOOL_IMPRESO}, n.estadosDe(id))
+	}
+}
+
+func TestEscPosSpoolerCerradaAlEncolar(t *testing.T) {
+	// La cola se cierra entre la notificación EN_COLA y el encolado: sin persistencia, el trabajo termina FALLIDO
+	n := nuevasNotificaciones()
+	var s *plantillas.EscPosSpooler
+	notifica := func(job plantillas.EscPosJob) {
+		if job.Estado == plantillas.SPOOL_EN_COLA {
+			s.Close()
+		}
+		n.notifica(job)
+	}
+	s, err := plantillas.NewEscPosSpooler(plantillas.EscPosSpoolerConfig{Notifica: notifica})
+	assert.NoError(t, err)
+	_, err = s.Enqueue(filepath.Join(t.TempDir(), "ticket.prn"), []byte("uno"))
+	assert.Error(t, err)
+	job := n.espera(t)
+	assert.Equal(t, "cola de impresión cerrada", job.Error)
+	assert.Equal(t, []string{plantillas.SPOOL_EN_COLA, plantillas.SPOOL_FALLIDO}, n.estadosDe(job.ID))
+}
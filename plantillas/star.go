@@ -0,0 +1,217 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Expresión regular de los parámetros y códigos de barras, que en Star Line Mode van en la misma orden
+var reBcAnyEscPos = regexp.MustCompile(`{bc-height ([0-9]+)}|{bc-modulo ([0-9]+)}|{bc-hri (none|above|below|both)}|` + reBarcodeEscPos.String())
+
+// Añade las órdenes Star Line Mode de cambio de estilo
+func estilosStar(result *bytes.Buffer, estado, nuevo tEstadoEstilos) {
+	if estado.alignment != nuevo.alignment {
+		// ESC GS a n
+		switch nuevo.alignment {
+		case 'l':
+			result.Write([]byte{ESC, GS, 'a', 0}) // left
+		case 'c':
+			result.Write([]byte{ESC, GS, 'a', 1}) // center
+		case 'r':
+			result.Write([]byte{ESC, GS, 'a', 2}) // right
+		}
+	}
+	if estado.isSmall != nuevo.isSmall {
+		// ESC RS F n
+		if nuevo.isSmall {
+			result.Write([]byte{ESC, RS, 'F', 1})
+		} else {
+			result.Write([]byte{ESC, RS, 'F', 0})
+		}
+	}
+	if estado.isBold != nuevo.isBold {
+		// ESC E / ESC F
+		if nuevo.isBold {
+			result.Write([]byte{ESC, 'E'})
+		} else {
+			result.Write([]byte{ESC, 'F'})
+		}
+	}
+	if estado.isUnderline != nuevo.isUnderline {
+		// ESC - n
+		if nuevo.isUnderline {
+			result.Write([]byte{ESC, '-', 1})
+		} else {
+			result.Write([]byte{ESC, '-', 0})
+		}
+	}
+	if estado.isDoubleX != nuevo.isDoubleX || estado.isDoubleY != nuevo.isDoubleY {
+		// ESC i n1 n2 (ampliación vertical y horizontal)
+		var alto, ancho byte
+		if nuevo.isDoubleY {
+			alto = 1
+		}
+		if nuevo.isDoubleX {
+			ancho = 1
+		}
+		result.Write([]byte{ESC, 'i', alto, ancho})
+	}
+	if estado.isUpsideDown != nuevo.isUpsideDown {
+		// SI / DC2
+		if nuevo.isUpsideDown {
+			result.WriteByte(SI)
+		} else {
+			result.WriteByte(DC2)
+		}
+	}
+	if estado.isReverse != nuevo.isReverse {
+		// ESC 4 / ESC 5
+		if nuevo.isReverse {
+			result.Write([]byte{ESC, '4'})
+		} else {
+			result.Write([]byte{ESC, '5'})
+		}
+	}
+}
+
+// Procesa los códigos de barras STAR.
+// La altura, el módulo y el texto se incluyen en cada código de barras: ESC b n1 n2 n3 n4 datos RS
+func processStarBarcodes(escpos []byte, perfil EscPosProfile) []byte {
+	var altura byte = 162
+	var modulo byte = 3
+	var hri byte = '3' // Sin texto ni salto de línea
+	result := reBcAnyEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
+		submatches := reBcAnyEscPos.FindSubmatch(match)
+		switch {
+		case submatches[1] != nil:
+			h := bytesToByte(submatches[1])
+			if h == 0 {
+				return match
+			}
+			altura = h
+			return nil
+		case submatches[2] != nil:
+			m := bytesToByte(submatches[2])
+			if int(m) < perfil.BcModuloMin || int(m) > perfil.BcModuloMax {
+				return match
+			}
+			modulo = m
+			return nil
+		case submatches[3] != nil:
+			if string(submatches[3]) == "none" {
+				hri = '3' // Sin texto ni salto de línea
+			} else {
+				hri = '4' // Texto debajo, sin salto de línea
+			}
+			return nil
+		}
+		tipo := string(submatches[4])
+		codigo := submatches[5]
+		var l byte
+		if len(codigo) <= perfil.BcLongitud {
+			l = byte(len(codigo))
+		}
+		if l == 0 || !perfil.soportaBarcode(tipo) {
+			return match
+		}
+		orden := func(n1 byte, datos []byte) []byte {
+			b := append([]byte{ESC, 'b', n1, hri, modulo - 1, altura}, datos...)
+			return append(b, RS) // ESC b n1 n2 n3 n4 ... RS
+		}
+		switch tipo {
+		case "code128", "code128a", "code128b":
+			// La impresora selecciona las variantes automáticamente
+			if bytesInRange(codigo, [][]byte{{0, 127}}) {
+				return orden('6', codigo)
+			}
+		case "code128c":
+			if l%2 == 0 && bytesInRange(codigo, [][]byte{{'0', '9'}}) {
+				return orden('6', codigo)
+			}
+		case "itf":
+			if l%2 == 0 && bytesInRange(codigo, [][]byte{{'0', '9'}}) {
+				return orden('5', codigo)
+			}
+		case "upc-a":
+			if (l == 11 || l == 12) && bytesInRange(codigo, [][]byte{{'0', '9'}}) {
+				return orden('1', codigo)
+			}
+		case "upc-e":
+			if (l == 7 || l == 11) && bytesInRange(codigo, [][]byte{{'0', '9'}}) && codigo[0] == '0' {
+				return orden('0', codigo)
+			}
+		case "ean-13":
+			if l == 12 && bytesInRange(codigo, [][]byte{{'0', '9'}}) {
+				return orden('3', codigo)
+			}
+		case "ean-8":
+			if l == 7 && bytesInRange(codigo, [][]byte{{'0', '9'}}) {
+				return orden('2', codigo)
+			}
+		case "code39":
+			if bytesInRange(codigo, [][]byte{{'0', '9'}, {'A', 'Z'}}, ' ', '$', '%', '*', '+', '-', '.', '/') {
+				return orden('4', codigo)
+			}
+		case "code93":
+			if bytesInRange(codigo, [][]byte{{0, 127}}) {
+				return orden('7', codigo)
+			}
+		case "codabar":
+			if bytesInRange(codigo, [][]byte{{'0', '9'}}, '$', '+', '-', '.', '/', ':') {
+				return orden('8', append(append([]byte{'A'}, codigo...), 'A'))
+			}
+			if bytesInRange(codigo, [][]byte{{'0', '9'}, {'A', 'D'}, {'a', 'd'}}, '$', '+', '-', '.', '/', ':') {
+				return orden('8', codigo)
+			}
+		}
+		return match
+	})
+	return result
+}
+
+// Procesa los códigos QR STAR
+func processStarQR(escpos []byte, perfil EscPosProfile) []byte {
+	result := reQrModuloEscPos.ReplaceAllFunc(escpos, func(match []byte) []byte {
+		submatches := reQrModuloEscPos.FindSubmatch(match)
+		m := bytesToByte(submatches[1])
+		if m >= 1 && int(m) <= perfil.QrModuloMax {
+			return []byte{ESC, GS, 'y', 'S', '2', m} // ESC GS y S 2 n
+		}
+		return match
+	})
+	result = reQrEccEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		submatches := reQrEccEscPos.FindSubmatch(match)
+		switch string(submatches[1]) {
+		case "L":
+			return []byte{ESC, GS, 'y', 'S', '1', 0} // ESC GS y S 1 0
+		case "M":
+			return []byte{ESC, GS, 'y', 'S', '1', 1} // ESC GS y S 1 1
+		case "Q":
+			return []byte{ESC, GS, 'y', 'S', '1', 2} // ESC GS y S 1 2
+		case "H":
+			return []byte{ESC, GS, 'y', 'S', '1', 3} // ESC GS y S 1 3
+		default:
+			return match
+		}
+	})
+	result = reQrEscPos.ReplaceAllFunc(result, func(match []byte) []byte {
+		submatches := reQrEscPos.FindSubmatch(match)
+		codigo := submatches[1]
+		p := len(codigo)
+		if p < 1 || p > 7089 {
+			return match
+		}
+		datos := []byte{ESC, GS, 'y', 'S', '0', 2}                            // ESC GS y S 0 2 (modelo 2)
+		datos = append(datos, ESC, GS, 'y', 'D', '1', 0, byte(p), byte(p>>8)) // ESC GS y D 1 0 nL nH
+		datos = append(datos, codigo...)                                      // codigo
+		datos = append(datos, ESC, GS, 'y', 'P')                              // ESC GS y P
+		return datos
+	})
+	return result
+}
+
+// Procesa las imágenes STAR: ESC GS S 1 xL xH yL yH 0 raster
+func processStarImg(escpos []byte, puntos int) []byte {
+	return processImg(escpos, RASTER_ESC_GS_S, puntos)
+}
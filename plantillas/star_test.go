@@ -0,0 +1,39 @@
+package plantillas_test
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateStar(t *testing.T) {
+	bin, width, err := plantillas.GenerateEscPos("{cb}Hola{}\n{bc-height 80}{bc-hri below}{ean-8 1234567}\n{qr-ecc M}{qr X}{partial-cut}", plantillas.STAR)
+	assert.NoError(t, err)
+	assert.Equal(t, 80, width)
+	esperado := []byte{plantillas.ESC, '@', plantillas.ESC, plantillas.GS, 't', 32}
+	esperado = append(esperado, plantillas.ESC, plantillas.GS, 'a', 1, plantillas.ESC, 'E')
+	esperado = append(esperado, "Hola"...)
+	esperado = append(esperado, plantillas.ESC, plantillas.GS, 'a', 0, plantillas.ESC, 'F', plantillas.LF)
+	esperado = append(esperado, plantillas.ESC, 'b', '2', '4', 2, 80)
+	esperado = append(esperado, "1234567"...)
+	esperado = append(esperado, plantillas.RS, plantillas.LF)
+	esperado = append(esperado, plantillas.ESC, plantillas.GS, 'y', 'S', '1', 1)
+	esperado = append(esperado, plantillas.ESC, plantillas.GS, 'y', 'S', '0', 2, plantillas.ESC, plantillas.GS, 'y', 'D', '1', 0, 1, 0, 'X', plantillas.ESC, plantillas.GS, 'y', 'P')
+	esperado = append(esperado, plantillas.ESC, 'd', '1')
+	assert.Equal(t, esperado, bin)
+}
+
+func TestGenerateStarPlantilla(t *testing.T) {
+	p, err := os.ReadFile("plantilla.escpos")
+	assert.NoError(t, err)
+	f, err := plantillas.MergeEscPosTemplate("plantilla.escpos", string(p), factura, "", formato.DMA, formato.EUR)
+	assert.NoError(t, err)
+	bin, _, err := plantillas.GenerateEscPos(f, plantillas.STAR)
+	assert.NoError(t, err)
+	// Todos los comandos se han procesado
+	assert.Empty(t, regexp.MustCompile(`{[a-z0-9 -]+}`).FindAll(bin, -1))
+}
@@ -0,0 +1,142 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Validación de plantillas esc/pos fusionadas: cada comando {...} se procesa por separado con el perfil de la
+// impresora y se informa de los que quedarían sin procesar (y se imprimirían como texto) o harían fallar la generación.
+
+// Posible comando: nombre en minúsculas, opcionalmente seguido de parámetros. Las llaves que no empiezan por
+// una letra (p.e. "{ 1, 2 }") se consideran texto.
+var reComandoEscPos = regexp.MustCompile(`{(?:([a-z][a-z0-9-]*)(?: [^{}]*)?)?}`)
+
+// Sintaxis de los comandos conocidos, por nombre
+var comandosEscPos = map[string]*regexp.Regexp{
+	"reset":        reResetEscPos,
+	"full-cut":     reFullCutEscPos,
+	"partial-cut":  rePartialCutEscPos,
+	"form-feed":    reFormFeedEscPos,
+	"paper-width":  rePaperWidthEscPos,
+	"bc-height":    reBcHeightEscPos,
+	"bc-modulo":    reBcModuloEscPos,
+	"bc-hri":       reBcHriEscPos,
+	"qr-modulo":    reQrModuloEscPos,
+	"qr-ecc":       reQrEccEscPos,
+	"qr":           reQrEscPos,
+	"img":          reImgEscPos,
+	"nv-img":       reNvImgEscPos,
+	"page":         rePageEscPos,
+	"page-dir":     rePageDirEscPos,
+	"pos":          rePosEscPos,
+	"end-page":     reEndPageEscPos,
+	"2d-modulo":    re2DEscPos,
+	"pdf417-ecc":   re2DEscPos,
+	"aztec-ecc":    re2DEscPos,
+	"pdf417":       re2DEscPos,
+	"datamatrix":   re2DEscPos,
+	"aztec":        re2DEscPos,
+	"drawer":       reDrawerEscPos,
+	"beep":         reBeepEscPos,
+	"buzzer":       reBuzzerEscPos,
+	"line-spacing": reLineSpacingEscPos,
+	"char-spacing": reCharSpacingEscPos,
+	"font":         reFontEscPos,
+	"left-margin":  reLeftMarginEscPos,
+	"print-width":  rePrintWidthEscPos,
+}
+
+func init() {
+	for _, bc := range []string{"code128", "code128a", "code128b", "code128c", "itf", "upc-a", "upc-e", "ean-13", "ean-8", "code39", "code93", "codabar"} {
+		comandosEscPos[bc] = reBarcodeEscPos
+	}
+}
+
+// Problema detectado en una plantilla esc/pos
+type EscPosIssue struct {
+	Linea   int    // Línea, desde 1
+	Columna int    // Columna en caracteres, desde 1
+	Comando string // Comando tal y como aparece en la plantilla, p.e. {qr-modulo 40}
+	Mensaje string // Descripción del problema
+}
+
+// Problema en formato "línea:columna: {comando}: mensaje"
+func (p EscPosIssue) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", p.Linea, p.Columna, p.Comando, p.Mensaje)
+}
+
+// Error devuelto por GenerateEscPosProfile en modo estricto, con todos los problemas de la plantilla
+type EscPosValidationError []EscPosIssue
+
+func (e EscPosValidationError) Error() string {
+	s := make([]string, len(e))
+	for k, p := range e {
+		s[k] = p.String()
+	}
+	return "plantilla esc/pos no válida: " + strings.Join(s, "; ")
+}
+
+// Valida una plantilla esc/pos fusionada (ver MergeEscPosTemplate) para una impresora, sin generarla. Devuelve los
+// comandos desconocidos, con parámetros no válidos o fuera de rango, con códigos no válidos o no soportados por
+// la impresora, en el orden en que aparecen.
+func ValidateEscPos(escpos string, perfil EscPosProfile) []EscPosIssue {
+	perfil = perfil.copia()
+	perfil.Estricto = false
+	var problemas []EscPosIssue
+	for _, m := range reComandoEscPos.FindAllStringSubmatchIndex(escpos, -1) {
+		comando := escpos[m[0]:m[1]]
+		nombre := ""
+		if m[2] >= 0 {
+			nombre = escpos[m[2]:m[3]]
+		}
+		mensaje := validaComando(comando, nombre, perfil)
+		if mensaje != "" {
+			linea := strings.Count(escpos[:m[0]], "\n") + 1
+			inicio := strings.LastIndexByte(escpos[:m[0]], '\n') + 1
+			problemas = append(problemas, EscPosIssue{
+				Linea:   linea,
+				Columna: utf8.RuneCountInString(escpos[inicio:m[0]]) + 1,
+				Comando: comando,
+				Mensaje: mensaje,
+			})
+		}
+	}
+	return problemas
+}
+
+// Valida un comando, devuelve el problema o vacío si es correcto
+func validaComando(comando, nombre string, perfil EscPosProfile) string {
+	re, ok := comandosEscPos[nombre]
+	switch {
+	case ok:
+		if !re.MatchString(comando) || re.FindString(comando) != comando {
+			return "sintaxis no válida"
+		}
+	case reEstilosEscPos.MatchString(comando):
+	case strings.IndexFunc(comando[1:len(comando)-1], func(r rune) bool { return r < 'a' || r > 'z' }) < 0:
+		// Solo letras: comando desconocido o estilo con letras desconocidas
+		var letras []string
+		for _, l := range comando[1 : len(comando)-1] {
+			if !strings.ContainsRune("whsbuoxlrc", l) {
+				letras = append(letras, string(l))
+			}
+		}
+		return fmt.Sprintf("comando desconocido o estilo con letras no válidas (%s)", strings.Join(letras, ", "))
+	default:
+		return "comando desconocido"
+	}
+	// Procesamos el comando aislado: si queda en el binario, se imprimiría como texto
+	bin, _, err := GenerateEscPosProfile(comando, perfil)
+	if err != nil {
+		return err.Error()
+	}
+	if bytes.Contains(bin, codificaTexto(comando, perfil.CodePage)) {
+		return fmt.Sprintf("valor no válido o no soportado por la impresora %s", perfil.Nombre)
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package plantillas_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEscPos(t *testing.T) {
+	// La plantilla de ejemplo es válida en EPSON, en SEIKO no hay code93
+	plantilla, err := os.ReadFile("plantilla.escpos")
+	errores.PanicIfError(err)
+	f, err := plantillas.MergeEscPosTemplate("escpos", string(plantilla), factura, "", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	epson, _ := plantillas.GetEscPosProfile("epson")
+	assert.Empty(t, plantillas.ValidateEscPos(f, epson))
+	seiko, _ := plantillas.GetEscPosProfile("seiko")
+	problemas := plantillas.ValidateEscPos(f, seiko)
+	if assert.Len(t, problemas, 1) {
+		assert.Equal(t, "{code93 123456}", problemas[0].Comando)
+		assert.Equal(t, "valor no válido o no soportado por la impresora seiko", problemas[0].Mensaje)
+	}
+	// Problemas con línea y columna
+	problemas = plantillas.ValidateEscPos("{c}Título{}\n{qr-modulo 40}{qr ABC}\nañ {i}x{} {bq} {bip}\n{ean-13 12}{bc-hri top}\n{ 1, 2 }", epson)
+	assert.Equal(t, []plantillas.EscPosIssue{
+		{Linea: 2, Columna: 1, Comando: "{qr-modulo 40}", Mensaje: "valor no válido o no soportado por la impresora epson"},
+		{Linea: 3, Columna: 4, Comando: "{i}", Mensaje: "comando desconocido o estilo con letras no válidas (i)"},
+		{Linea: 3, Columna: 11, Comando: "{bq}", Mensaje: "comando desconocido o estilo con letras no válidas (q)"},
+		{Linea: 3, Columna: 16, Comando: "{bip}", Mensaje: "comando desconocido o estilo con letras no válidas (i, p)"},
+		{Linea: 4, Columna: 1, Comando: "{ean-13 12}", Mensaje: "valor no válido o no soportado por la impresora epson"},
+		{Linea: 4, Columna: 12, Comando: "{bc-hri top}", Mensaje: "sintaxis no válida"},
+	}, problemas)
+	assert.Equal(t, "2:1: {qr-modulo 40}: valor no válido o no soportado por la impresora epson", problemas[0].String())
+}
+
+func TestGenerateEscPosStrict(t *testing.T) {
+	// Fuera del modo estricto las letras de estilo desconocidas se imprimen como texto
+	bin, _, err := plantillas.GenerateEscPos("{i}hola\n", plantillas.EPSON)
+	assert.NoError(t, err)
+	assert.Contains(t, string(bin), "{i}hola")
+	_, _, err = plantillas.GenerateEscPosStrict("Hola\n{qr-modulo 40}{pos 1 2}\n", plantillas.SEIKO)
+	var e plantillas.EscPosValidationError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Len(t, e, 2)
+		assert.Equal(t, "{pos 1 2}", e[1].Comando)
+	}
+	assert.Equal(t, "plantilla esc/pos no válida: 2:1: {qr-modulo 40}: valor no válido o no soportado por la impresora seiko; 2:15: {pos 1 2}: valor no válido o no soportado por la impresora seiko", err.Error())
+	// Sin problemas genera lo mismo que en modo normal
+	b1, w1, err := plantillas.GenerateEscPosStrict("{b}Hola{}\n{qr-modulo 4}{qr ABC}\n", plantillas.SEIKO)
+	assert.NoError(t, err)
+	b2, w2, err := plantillas.GenerateEscPos("{b}Hola{}\n{qr-modulo 4}{qr ABC}\n", plantillas.SEIKO)
+	assert.NoError(t, err)
+	assert.Equal(t, b2, b1)
+	assert.Equal(t, w2, w1)
+}
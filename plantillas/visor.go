@@ -0,0 +1,296 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+)
+
+// Visores de cliente (pole displays) de 2 líneas de 20 caracteres. Las plantillas se fusionan con los datos con
+// MergeDisplayTemplate y se convierten a binario con GenerateDisplay. Cada línea de la plantilla es una línea del visor,
+// y puede empezar por:
+//   - {l}, {c} o {r}: alineación del texto (por defecto a la izquierda). Los textos largos se recortan a 20 caracteres
+//   - {scroll}: texto desplazable. En la línea superior de los visores CD5220 el texto se desplaza continuamente
+//     (ESC Q D); en el resto se escribe en modo de desplazamiento horizontal y quedan visibles los últimos 20 caracteres
+//
+// Comandos, que se envían antes que el texto:
+//   - {clear}: borra el visor
+//   - {brightness n}: brillo del visor (1-4)
+//
+// Las líneas que no aparecen en la plantilla no se modifican, p.e. "{clear}" solo borra el visor.
+
+// Juegos de comandos de los visores de cliente
+const (
+	DISPLAY_EPSON  = 1 // Visores esc/pos: Epson DM-D, Bixolon BCD, Posiflex PD. Página de códigos Windows-1252
+	DISPLAY_CD5220 = 2 // Visores CD5220, la mayoría de los visores VFD genéricos. Página de códigos 437
+)
+
+// Códigos de control de los visores
+const (
+	DC1 = byte(0x11)
+	DC3 = byte(0x13)
+	CAN = byte(0x18)
+	US  = byte(0x1f)
+)
+
+// Dimensiones de los visores, en caracteres
+const (
+	columnasVisor = 20
+	lineasVisor   = 2
+)
+
+var reComandosDisplay = regexp.MustCompile(`{clear}|{brightness ([0-9]+)}`)
+var rePrefijoDisplay = regexp.MustCompile(`^{(l|c|r|scroll)}`)
+
+// Órdenes de un juego de comandos: prefijos a los que se añaden los argumentos
+type tOrdenesVisor struct {
+	inicio      []byte   // Oculta el cursor y selecciona la página de códigos
+	brillo      []byte   // Brillo n (1-4)
+	sobrescribe []byte   // Modo sobrescritura
+	desplaza    []byte   // Modo desplazamiento horizontal
+	cursor      []byte   // Cursor en la columna x y la línea y (desde 1)
+	cp          CodePage // Página de códigos
+}
+
+var ordenesVisor = map[int]tOrdenesVisor{
+	DISPLAY_EPSON: {
+		inicio:      []byte{ESC, 't', 16, US, 'C', 0}, // ESC t n, US C n
+		brillo:      []byte{US, 'X'},                  // US X n
+		sobrescribe: []byte{US, 0x01},                 // US MD1
+		desplaza:    []byte{US, 0x03},                 // US MD3
+		cursor:      []byte{US, '$'},                  // US $ x y
+		cp:          CP1252,
+	},
+	DISPLAY_CD5220: {
+		inicio:      []byte{ESC, '_', 0}, // ESC _ n
+		brillo:      []byte{ESC, '*'},    // ESC * n
+		sobrescribe: []byte{ESC, DC1},    // ESC DC1
+		desplaza:    []byte{ESC, DC3},    // ESC DC3
+		cursor:      []byte{ESC, 'l'},    // ESC l x y
+		cp:          CP437,
+	},
+}
+
+// Fusiona una plantilla de visor de cliente con un struct o map de datos.
+//   - name: nombre arbitrario para la plantilla que aparece en los mensajes de error
+//   - plantilla: plantilla del visor
+//   - datos: estructura de datos para fusionar con la plantilla
+//   - ff: formato de las fechas para las funciones DATETIME y DATE
+//   - fp: formato de los precios para la funcion PRICE
+//
+// Se soportan las funciones DATETIME, DATE, TIME, PRICE (sin relleno), VAT y VATINC, y COLS y WRAP con el ancho del visor:
+// {{COLS "l* r8" .Service (PRICE .Price)}}
+func MergeDisplayTemplate(name, plantilla string, datos any, ff formato.Fecha, fp formato.Moneda) (string, error) {
+	var funciones = template.FuncMap{
+		"PRICE": func(f float64) string {
+			return formato.PrintPrecio(f, fp, formato.DECIMALES_DEFECTO)
+		},
+		"COLS": func(spec string, valores ...any) string {
+			return columnasTexto(columnasVisor, spec, spec, valores...)
+		},
+		"WRAP": func(texto string, ancho ...int) string {
+			if len(ancho) == 0 {
+				ancho = []int{columnasVisor}
+			}
+			errores.PanicIfTrue(ancho[0] < 1, "WRAP: ancho %d no válido", ancho[0])
+			return strings.Join(wrapTexto(texto, ancho[0]), "\n")
+		},
+	}
+	for nombre, f := range funcionesFecha(ff) {
+		funciones[nombre] = f
+	}
+	for nombre, f := range funcionesImpuestos(fp) {
+		funciones[nombre] = f
+	}
+	var opt string
+	if reflect.TypeOf(datos).Kind() == reflect.Map {
+		// En los mapas se permite que falten campos
+		opt = "missingkey=zero"
+	} else {
+		// En las estructuras se exige la existencia del dato
+		opt = "missingkey=error"
+	}
+	tmpl, err := template.New(name).Funcs(funciones).Option(opt).Parse(plantilla)
+	if err != nil {
+		return "", err
+	}
+	var marshaled bytes.Buffer
+	err = tmpl.Execute(&marshaled, datos)
+	if err != nil {
+		return "", err
+	}
+	return marshaled.String(), nil
+}
+
+// Genera el binario para un visor de cliente a partir de una plantilla ya fusionada.
+// Parámetro juego: DISPLAY_EPSON/DISPLAY_CD5220
+func GenerateDisplay(plantilla string, juego int) ([]byte, error) {
+	ordenes, ok := ordenesVisor[juego]
+	if !ok {
+		return nil, fmt.Errorf("juego de comandos de visor %d no soportado", juego)
+	}
+	bin := append([]byte{}, ordenes.inicio...)
+
+	// Comandos
+	var err error
+	texto := reComandosDisplay.ReplaceAllStringFunc(plantilla, func(match string) string {
+		submatches := reComandosDisplay.FindStringSubmatch(match)
+		if submatches[1] == "" {
+			bin = append(bin, FF) // CLR
+			return ""
+		}
+		n, _ := strconv.Atoi(submatches[1])
+		if n < 1 || n > 4 {
+			err = fmt.Errorf("brillo %d no válido (1-4)", n)
+		}
+		bin = append(append(bin, ordenes.brillo...), byte(n))
+		return ""
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Líneas
+	texto = strings.TrimSuffix(strings.ReplaceAll(texto, "\r", ""), "\n")
+	if texto == "" {
+		return bin, nil
+	}
+	lineas := strings.Split(texto, "\n")
+	if len(lineas) > lineasVisor {
+		return nil, fmt.Errorf("la plantilla tiene %d líneas y el visor %d", len(lineas), lineasVisor)
+	}
+	for y, linea := range lineas {
+		alineacion := byte('l')
+		scroll := false
+		for m := rePrefijoDisplay.FindStringSubmatch(linea); m != nil; m = rePrefijoDisplay.FindStringSubmatch(linea) {
+			if m[1] == "scroll" {
+				scroll = true
+			} else {
+				alineacion = m[1][0]
+			}
+			linea = linea[len(m[0]):]
+		}
+		runas := []rune(linea)
+		switch {
+		case !scroll || len(runas) <= columnasVisor:
+			if len(runas) > columnasVisor {
+				linea = string(runas[:columnasVisor])
+			}
+			bin = append(bin, ordenes.sobrescribe...)
+			bin = append(append(bin, ordenes.cursor...), 1, byte(y+1))
+			bin = append(bin, codificaTexto(alineaTexto(linea, columnasVisor, alineacion), ordenes.cp)...)
+		case juego == DISPLAY_CD5220 && y == 0:
+			bin = append(bin, ESC, 'Q', 'D') // ESC Q D texto CR
+			bin = append(append(bin, codificaTexto(linea, ordenes.cp)...), CR)
+		default:
+			bin = append(bin, ordenes.desplaza...)
+			bin = append(append(bin, ordenes.cursor...), 1, byte(y+1))
+			bin = append(bin, codificaTexto(linea, ordenes.cp)...)
+		}
+	}
+	return bin, nil
+}
+
+// Vista previa en texto de un binario de visor de cliente, para pruebas: las dos líneas del visor enmarcadas.
+// Los textos desplazables de la línea superior de los visores CD5220 se muestran desde el principio.
+// Parámetro juego: DISPLAY_EPSON/DISPLAY_CD5220
+func PreviewDisplay(bin []byte, juego int) (string, error) {
+	ordenes, ok := ordenesVisor[juego]
+	if !ok {
+		return "", fmt.Errorf("juego de comandos de visor %d no soportado", juego)
+	}
+	cm := paginasCodigos[ordenes.cp].charmap
+	var pantalla [lineasVisor][columnasVisor]rune
+	borra := func() {
+		for y := range pantalla {
+			for x := range pantalla[y] {
+				pantalla[y][x] = ' '
+			}
+		}
+	}
+	borra()
+	x, y := 0, 0
+	desplaza := false
+	escribe := func(r rune) {
+		if x >= columnasVisor {
+			if desplaza {
+				copy(pantalla[y][:], pantalla[y][1:])
+				x = columnasVisor - 1
+			} else {
+				x, y = 0, (y+1)%lineasVisor
+			}
+		}
+		pantalla[y][x] = r
+		x++
+	}
+	for i := 0; i < len(bin); i++ {
+		resto := bin[i:]
+		switch {
+		case bytes.HasPrefix(resto, ordenes.sobrescribe):
+			desplaza = false
+			i += len(ordenes.sobrescribe) - 1
+		case bytes.HasPrefix(resto, ordenes.desplaza):
+			desplaza = true
+			i += len(ordenes.desplaza) - 1
+		case bytes.HasPrefix(resto, ordenes.cursor) && len(resto) >= len(ordenes.cursor)+2:
+			x = min(max(int(resto[len(ordenes.cursor)])-1, 0), columnasVisor-1)
+			y = min(max(int(resto[len(ordenes.cursor)+1])-1, 0), lineasVisor-1)
+			i += len(ordenes.cursor) + 1
+		case bytes.HasPrefix(resto, ordenes.brillo), bytes.HasPrefix(resto, []byte{ESC, '_'}), bytes.HasPrefix(resto, []byte{US, 'C'}):
+			i += 2
+		case bytes.HasPrefix(resto, []byte{ESC, 't'}) && len(resto) > 2:
+			if c := charmapEscT(resto[2], false); c != nil {
+				cm = c
+			}
+			i += 2
+		case bytes.HasPrefix(resto, []byte{ESC, '@'}):
+			borra()
+			x, y, desplaza = 0, 0, false
+			i++
+		case bytes.HasPrefix(resto, []byte{ESC, 'Q', 'D'}):
+			// Texto desplazable en la línea superior hasta CR
+			fin := bytes.IndexByte(resto, CR)
+			if fin < 0 {
+				fin = len(resto)
+			}
+			for k := range pantalla[0] {
+				pantalla[0][k] = ' '
+				if 3+k < fin {
+					pantalla[0][k] = cm.DecodeByte(resto[3+k])
+				}
+			}
+			i += fin
+		case resto[0] == FF:
+			borra()
+			x, y = 0, 0
+		case resto[0] == CAN:
+			for k := range pantalla[y] {
+				pantalla[y][k] = ' '
+			}
+		case resto[0] == CR:
+			x = 0
+		case resto[0] == LF:
+			y = (y + 1) % lineasVisor
+		case resto[0] == ESC || resto[0] == US:
+			i++ // Orden desconocida
+		case resto[0] >= ' ':
+			escribe(cm.DecodeByte(resto[0]))
+		}
+	}
+	var result strings.Builder
+	borde := "+" + strings.Repeat("-", columnasVisor) + "+\n"
+	result.WriteString(borde)
+	for _, linea := range pantalla {
+		result.WriteString("|" + string(linea[:]) + "|\n")
+	}
+	result.WriteString(borde)
+	return result.String(), nil
+}
@@ -0,0 +1,86 @@
+package plantillas_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func ExampleGenerateDisplay() {
+	plantilla := `{clear}{brightness 4}{{COLS "l* r8" "Total" (PRICE .Total)}}
+{c}¡Gracias!`
+	texto, err := plantillas.MergeDisplayTemplate("visor", plantilla, factura, formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	bin, err := plantillas.GenerateDisplay(texto, plantillas.DISPLAY_EPSON)
+	errores.PanicIfError(err)
+	preview, err := plantillas.PreviewDisplay(bin, plantillas.DISPLAY_EPSON)
+	errores.PanicIfError(err)
+	fmt.Print(preview)
+	// Output:
+	// +--------------------+
+	// |Total        15,06 €|
+	// |     ¡Gracias!      |
+	// +--------------------+
+}
+
+func TestGenerateDisplay(t *testing.T) {
+	const ESC, US, FF = plantillas.ESC, plantillas.US, plantillas.FF
+	bin, err := plantillas.GenerateDisplay("{clear}{brightness 2}{c}Hola\n", plantillas.DISPLAY_EPSON)
+	assert.NoError(t, err)
+	esperado := []byte{ESC, 't', 16, US, 'C', 0, FF, US, 'X', 2, US, 1, US, '$', 1, 1}
+	esperado = append(esperado, "        Hola        "...)
+	assert.Equal(t, esperado, bin)
+	bin, err = plantillas.GenerateDisplay("{brightness 1}\n{r}12,50 €", plantillas.DISPLAY_CD5220)
+	assert.NoError(t, err)
+	esperado = []byte{ESC, '_', 0, ESC, '*', 1, ESC, plantillas.DC1, ESC, 'l', 1, 1}
+	esperado = append(esperado, strings.Repeat(" ", 20)...)
+	esperado = append(esperado, ESC, plantillas.DC1, ESC, 'l', 1, 2)
+	esperado = append(esperado, "             12,50 ?"...) // Sin € en la página 437
+	assert.Equal(t, esperado, bin)
+	// Solo comandos
+	bin, err = plantillas.GenerateDisplay("{clear}", plantillas.DISPLAY_CD5220)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{ESC, '_', 0, FF}, bin)
+	// Errores
+	_, err = plantillas.GenerateDisplay("{brightness 5}", plantillas.DISPLAY_EPSON)
+	assert.Error(t, err)
+	_, err = plantillas.GenerateDisplay("uno\ndos\ntres", plantillas.DISPLAY_EPSON)
+	assert.Error(t, err)
+	_, err = plantillas.GenerateDisplay("hola", 0)
+	assert.Error(t, err)
+}
+
+func TestPreviewDisplay(t *testing.T) {
+	preview := func(plantilla string, juego int) string {
+		bin, err := plantillas.GenerateDisplay(plantilla, juego)
+		assert.NoError(t, err)
+		p, err := plantillas.PreviewDisplay(bin, juego)
+		assert.NoError(t, err)
+		return p
+	}
+	largo := "Ofertas de temporada en toda la tienda"
+	// Desplazamiento horizontal: quedan visibles los últimos 20 caracteres
+	assert.Equal(t, "+--------------------+\n|Café con leche      |\n|en toda la tienda   |\n+--------------------+\n",
+		preview("Café con leche\n{scroll}"+largo+"   ", plantillas.DISPLAY_EPSON))
+	// Desplazamiento continuo en la línea superior CD5220, se muestra desde el principio
+	assert.Equal(t, "+--------------------+\n|Ofertas de temporada|\n|Café con leche      |\n+--------------------+\n",
+		preview("{scroll}"+largo+"\n{l}Café con leche", plantillas.DISPLAY_CD5220))
+	// Textos estáticos recortados y líneas sin modificar
+	assert.Equal(t, "+--------------------+\n|Ofertas de temporada|\n|                    |\n+--------------------+\n",
+		preview("{c}"+largo, plantillas.DISPLAY_EPSON))
+	_, err := plantillas.PreviewDisplay(nil, 3)
+	assert.Error(t, err)
+}
+
+func TestMergeDisplayTemplate(t *testing.T) {
+	texto, err := plantillas.MergeDisplayTemplate("visor", `{{WRAP .Texto}}`, map[string]any{"Texto": "Gracias por su visita, vuelva pronto"}, formato.DMA, formato.EUR)
+	assert.NoError(t, err)
+	assert.Equal(t, "Gracias por su\nvisita, vuelva\npronto", texto)
+	_, err = plantillas.MergeDisplayTemplate("visor", `{{.NoExiste}}`, factura, formato.DMA, formato.EUR)
+	assert.Error(t, err)
+}
@@ -0,0 +1,327 @@
+// Procesamiento de plantillas
+package plantillas
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/gomonobold"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Vista previa de tickets esc/pos como imagen PNG, a la resolución de la impresora y con la fuente Go Mono,
+// o como SVG. En ambos casos las etiquetas se muestran una debajo de otra, separadas por una línea de corte.
+
+// Fuentes Go Mono normal y negrita, se cargan la primera vez que se usan
+var fuentesMono = sync.OnceValues(func() ([2]*opentype.Font, error) {
+	var fuentes [2]*opentype.Font
+	var err error
+	fuentes[0], err = opentype.Parse(gomono.TTF)
+	if err != nil {
+		return fuentes, err
+	}
+	fuentes[1], err = opentype.Parse(gomonobold.TTF)
+	return fuentes, err
+})
+
+// Matriz identidad de una transformación [a b c d e f]: (x, y) -> (a*x + c*y + e, b*x + d*y + f)
+var matrizIdentidad = [6]float64{1, 0, 0, 1, 0, 0}
+
+// Imagen en blanco y negro de una etiqueta en construcción
+type tLienzo struct {
+	img    *image.Gray
+	matriz [6]float64
+	pila   [][6]float64
+	caras  map[[2]float64]font.Face
+}
+
+// Renderiza un []byte esc/pos (binario) a la resolución de la impresora: una imagen en blanco y negro por etiqueta,
+// del ancho imprimible de un papel de width mm (80 si es 0) y del alto de su contenido.
+func RenderEscPosImage(escpos []byte, width int) ([]*image.Gray, error) {
+	if width <= 0 {
+		width = 80
+	}
+	fuentes, err := fuentesMono()
+	if err != nil {
+		return nil, err
+	}
+	var imagenes []*image.Gray
+	caras := map[[2]float64]font.Face{}
+	defer func() {
+		for _, c := range caras {
+			c.Close()
+		}
+	}()
+	for _, et := range maquetaEscPos(escpos, width) {
+		l := &tLienzo{img: image.NewGray(image.Rect(0, 0, puntosPapel(width), et.alto)), matriz: matrizIdentidad, caras: caras}
+		draw.Draw(l.img, l.img.Rect, image.White, image.Point{}, draw.Src)
+		for _, o := range et.ops {
+			err = l.operacion(o, fuentes)
+			if err != nil {
+				return nil, err
+			}
+		}
+		imagenes = append(imagenes, l.img)
+	}
+	return imagenes, nil
+}
+
+// Escribe en formato PNG la vista previa de un []byte esc/pos (binario), a la resolución de la impresora.
+// Parámetro width: ancho del papel en mm, 80 si es 0.
+func WriteEscPosPng(w io.Writer, escpos []byte, width int) error {
+	etiquetas, err := RenderEscPosImage(escpos, width)
+	if err != nil {
+		return err
+	}
+	alto := 0
+	for _, et := range etiquetas {
+		alto += et.Rect.Dy() + 2*pdfMargen
+	}
+	img := image.NewGray(image.Rect(0, 0, etiquetas[0].Rect.Dx(), alto))
+	draw.Draw(img, img.Rect, image.White, image.Point{}, draw.Src)
+	y := 0
+	for k, et := range etiquetas {
+		draw.Draw(img, et.Rect.Add(image.Pt(0, y+pdfMargen)), et, image.Point{}, draw.Src)
+		y += et.Rect.Dy() + 2*pdfMargen
+		if k < len(etiquetas)-1 {
+			// Línea de corte discontinua
+			for x := 0; x < img.Rect.Dx(); x += 16 {
+				draw.Draw(img, image.Rect(x, y-1, x+8, y), image.NewUniform(color.Gray{Y: 128}), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// Procesa una operación de dibujo
+func (l *tLienzo) operacion(o tOperacion, fuentes [2]*opentype.Font) error {
+	switch o.tipo {
+	case opRects:
+		for _, r := range o.rects {
+			l.rect(r, 0)
+		}
+	case opTexto:
+		return l.texto(o, fuentes)
+	case opImagen:
+		r := o.imagen.Rect
+		for y := 0; y < r.Dy(); y++ {
+			for x := 0; x < r.Dx(); x++ {
+				if o.imagen.GrayAt(r.Min.X+x, r.Min.Y+y).Y < 128 {
+					l.punto(o.x+x, o.y+y, 0)
+				}
+			}
+		}
+	case opTransforma:
+		l.pila = append(l.pila, l.matriz)
+		l.matriz = componeMatrices(l.matriz, o.matriz)
+	case opRestaura:
+		if n := len(l.pila); n > 0 {
+			l.matriz = l.pila[n-1]
+			l.pila = l.pila[:n-1]
+		}
+	}
+	return nil
+}
+
+// Compone dos transformaciones: primero m y después base
+func componeMatrices(base, m [6]float64) [6]float64 {
+	return [6]float64{
+		base[0]*m[0] + base[2]*m[1],
+		base[1]*m[0] + base[3]*m[1],
+		base[0]*m[2] + base[2]*m[3],
+		base[1]*m[2] + base[3]*m[3],
+		base[0]*m[4] + base[2]*m[5] + base[4],
+		base[1]*m[4] + base[3]*m[5] + base[5],
+	}
+}
+
+// Pinta un punto de un color, aplicando la transformación en curso
+func (l *tLienzo) punto(x, y int, c uint8) {
+	m := l.matriz
+	fx, fy := float64(x)+0.5, float64(y)+0.5
+	px := int(math.Floor(m[0]*fx + m[2]*fy + m[4]))
+	py := int(math.Floor(m[1]*fx + m[3]*fy + m[5]))
+	if image.Pt(px, py).In(l.img.Rect) {
+		l.img.SetGray(px, py, color.Gray{Y: c})
+	}
+}
+
+// Pinta un rectángulo de un color
+func (l *tLienzo) rect(r image.Rectangle, c uint8) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			l.punto(x, y, c)
+		}
+	}
+}
+
+// Cara de la fuente Go Mono con un tamaño en puntos
+func (l *tLienzo) cara(tam float64, negrita bool, fuentes [2]*opentype.Font) (font.Face, error) {
+	k := 0
+	if negrita {
+		k = 1
+	}
+	clave := [2]float64{tam, float64(k)}
+	if c, ok := l.caras[clave]; ok {
+		return c, nil
+	}
+	c, err := opentype.NewFace(fuentes[k], &opentype.FaceOptions{Size: tam, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	l.caras[clave] = c
+	return c, nil
+}
+
+// Pinta un trozo de texto. Los caracteres se dibujan en celdas del tamaño normal y se escalan como en la impresora.
+func (l *tLienzo) texto(o tOperacion, fuentes [2]*opentype.Font) error {
+	t := o.trozo
+	tam, sx, sy, base := metricaTexto(t.estilo, o.y, o.alto)
+	cara, err := l.cara(tam, t.estilo.Negrita, fuentes)
+	if err != nil {
+		return err
+	}
+	tinta := uint8(0)
+	if t.estilo.Inverso {
+		l.rect(image.Rect(o.x, o.y, o.x+o.w, o.y+o.alto), 0)
+		tinta = 255
+	}
+	// Posición de un punto, girado 180º si el texto está invertido
+	punto := func(x, y int) {
+		if t.estilo.Invertido {
+			x, y = 2*o.x+o.w-1-x, 2*o.y+o.alto-1-y
+		}
+		l.punto(x, y, tinta)
+	}
+	ancho := anchoFuente(t.estilo) + t.estilo.Espaciado
+	celda := pdfInterlineado - pdfEspaciado
+	glifos := image.NewGray(image.Rect(0, 0, ancho*len(t.texto), celda))
+	draw.Draw(glifos, glifos.Rect, image.White, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: glifos, Src: image.Black, Face: cara}
+	for k, c := range t.texto {
+		d.Dot = fixed.Point26_6{X: fixed.I(k * ancho), Y: fixed.Int26_6((float64(celda) - 0.2*tam) * 64)}
+		d.DrawString(string(c))
+	}
+	arriba := o.y + o.alto - pdfEspaciado - celda*sy
+	for y := 0; y < celda*sy; y++ {
+		for x := 0; x < o.w; x++ {
+			if glifos.GrayAt(x/sx, y/sy).Y < 128 {
+				punto(o.x+x, arriba+y)
+			}
+		}
+	}
+	if t.estilo.Subrayado {
+		y0 := int(math.Round(base + 2))
+		for y := y0; y < y0+2; y++ {
+			for x := o.x; x < o.x+o.w; x++ {
+				punto(x, y)
+			}
+		}
+	}
+	return nil
+}
+
+// Escribe en formato SVG la vista previa de un []byte esc/pos (binario), en puntos de impresora.
+// Parámetro width: ancho del papel en mm, 80 si es 0.
+func WriteEscPosSvg(w io.Writer, escpos []byte, width int) error {
+	if width <= 0 {
+		width = 80
+	}
+	etiquetas := maquetaEscPos(escpos, width)
+	ancho := puntosPapel(width)
+	alto := 0
+	for _, et := range etiquetas {
+		alto += et.alto + 2*pdfMargen
+	}
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n", ancho, alto, ancho, alto)
+	svg.WriteString("<rect width=\"100%\" height=\"100%\" fill=\"#fff\"/>\n")
+	y := 0
+	for k, et := range etiquetas {
+		fmt.Fprintf(&svg, "<g transform=\"translate(0 %d)\">\n", y+pdfMargen)
+		for _, o := range et.ops {
+			operacionSvg(&svg, o)
+		}
+		svg.WriteString("</g>\n")
+		y += et.alto + 2*pdfMargen
+		if k < len(etiquetas)-1 {
+			fmt.Fprintf(&svg, "<line x1=\"0\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"#888\" stroke-dasharray=\"8\"/>\n", y, ancho, y)
+		}
+	}
+	svg.WriteString("</svg>\n")
+	_, err := w.Write(svg.Bytes())
+	return err
+}
+
+// Escribe una operación de dibujo en SVG
+func operacionSvg(svg *bytes.Buffer, o tOperacion) {
+	switch o.tipo {
+	case opRects:
+		svg.WriteString("<path d=\"")
+		for _, r := range o.rects {
+			fmt.Fprintf(svg, "M%d %dh%dv%dh%dz", r.Min.X, r.Min.Y, r.Dx(), r.Dy(), -r.Dx())
+		}
+		svg.WriteString("\"/>\n")
+	case opTexto:
+		textoSvg(svg, o)
+	case opImagen:
+		var b bytes.Buffer
+		png.Encode(&b, o.imagen)
+		fmt.Fprintf(svg, "<image x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" image-rendering=\"pixelated\" href=\"data:image/png;base64,%s\"/>\n",
+			o.x, o.y, o.imagen.Rect.Dx(), o.imagen.Rect.Dy(), base64.StdEncoding.EncodeToString(b.Bytes()))
+	case opTransforma:
+		m := o.matriz
+		fmt.Fprintf(svg, "<g transform=\"matrix(%s %s %s %s %s %s)\">\n", num(m[0]), num(m[1]), num(m[2]), num(m[3]), num(m[4]), num(m[5]))
+	case opRestaura:
+		svg.WriteString("</g>\n")
+	}
+}
+
+// Escribe un trozo de texto en SVG, escalado y girado con una transformación
+func textoSvg(svg *bytes.Buffer, o tOperacion) {
+	t := o.trozo
+	tam, sx, sy, base := metricaTexto(t.estilo, o.y, o.alto)
+	tinta := "#000"
+	if t.estilo.Inverso {
+		fmt.Fprintf(svg, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\"/>\n", o.x, o.y, o.w, o.alto)
+		tinta = "#fff"
+	}
+	transformacion := fmt.Sprintf("matrix(%d 0 0 %d %d %s)", sx, sy, o.x, num(base))
+	if t.estilo.Invertido {
+		transformacion = fmt.Sprintf("matrix(%d 0 0 %d %d %s)", -sx, -sy, o.x+o.w, num(float64(2*o.y+o.alto)-base))
+	}
+	if t.estilo.Subrayado {
+		y := base + 2
+		if t.estilo.Invertido {
+			y = float64(2*o.y+o.alto) - y - 2
+		}
+		fmt.Fprintf(svg, "<rect x=\"%d\" y=\"%s\" width=\"%d\" height=\"2\" fill=\"%s\"/>\n", o.x, num(y), o.w, tinta)
+	}
+	atributos := ""
+	if t.estilo.Negrita {
+		atributos = " font-weight=\"bold\""
+	}
+	if t.estilo.Espaciado > 0 {
+		atributos += fmt.Sprintf(" letter-spacing=\"%d\"", t.estilo.Espaciado)
+	}
+	texto := strings.Map(func(r rune) rune {
+		if r < ' ' {
+			return ' '
+		}
+		return r
+	}, string(t.texto))
+	fmt.Fprintf(svg, "<text transform=\"%s\" font-family=\"'DejaVu Sans Mono', monospace\" font-size=\"%s\" textLength=\"%d\" lengthAdjust=\"spacingAndGlyphs\" fill=\"%s\"%s xml:space=\"preserve\">%s</text>\n",
+		transformacion, num(tam), (anchoFuente(t.estilo)+t.estilo.Espaciado)*len(t.texto), tinta, atributos, escapaHTML.Replace(texto))
+}
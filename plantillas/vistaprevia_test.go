@@ -0,0 +1,96 @@
+package plantillas_test
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/formato"
+	"github.com/horus-es/go-util/v3/plantillas"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderEscPosImage(t *testing.T) {
+	plantilla, err := os.ReadFile("plantilla.escpos")
+	errores.PanicIfError(err)
+	f, err := plantillas.MergeEscPosTemplate("escpos", string(plantilla), factura, "/assets", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	epson, mm, err := plantillas.GenerateEscPos(f, plantillas.EPSON)
+	errores.PanicIfError(err)
+	seiko, _, err := plantillas.GenerateEscPos(f, plantillas.SEIKO)
+	errores.PanicIfError(err)
+	i1, err := plantillas.RenderEscPosImage(epson, mm)
+	assert.NoError(t, err)
+	i2, err := plantillas.RenderEscPosImage(seiko, mm)
+	assert.NoError(t, err)
+	assert.Len(t, i1, 2)
+	assert.Len(t, i2, 2)
+	// El recibo debe ser igual punto a punto si el esc/pos es sabor EPSON o sabor SEIKO
+	assert.Equal(t, 576, i1[0].Rect.Dx())
+	assert.Equal(t, i1[0].Rect, i2[0].Rect)
+	assert.Equal(t, i1[0].Pix, i2[0].Pix)
+}
+
+func TestRenderEscPosImageEstilos(t *testing.T) {
+	prn, mm, err := plantillas.GenerateEscPos("{paper-width 58}{o}AB{}\n{u}AB{}\n{h}AB{}\n{bc-height 40}{bc-hri none}{code128 1234}\n", plantillas.EPSON)
+	errores.PanicIfError(err)
+	img, err := plantillas.RenderEscPosImage(prn, mm)
+	assert.NoError(t, err)
+	if !assert.Len(t, img, 1) {
+		return
+	}
+	// Líneas de 30 puntos, doble alto de 54 y código de barras de 40
+	assert.Equal(t, 384, img[0].Rect.Dx())
+	assert.Equal(t, 30+30+54+40, img[0].Rect.Dy())
+	// Blanco sobre negro: fondo negro del trozo de texto y blanco a continuación
+	assert.Equal(t, uint8(0), img[0].GrayAt(0, 0).Y)
+	assert.Equal(t, uint8(0), img[0].GrayAt(23, 29).Y)
+	assert.Equal(t, uint8(255), img[0].GrayAt(24, 0).Y)
+	// Subrayado
+	for x := range 24 {
+		assert.Equal(t, uint8(0), img[0].GrayAt(x, 30+22).Y, "x=%d", x)
+	}
+	// Código de barras: empieza con una barra de 2 módulos de 3 puntos
+	assert.Equal(t, uint8(0), img[0].GrayAt(5, 114).Y)
+	assert.Equal(t, uint8(255), img[0].GrayAt(6, 114).Y)
+}
+
+func TestWriteEscPosSvg(t *testing.T) {
+	prn, mm, err := plantillas.GenerateEscPos("{b}A<B & C{}\n{x}Hola{}\n{qr ABC}\n{full-cut}\nFin\n", plantillas.EPSON)
+	errores.PanicIfError(err)
+	var svg bytes.Buffer
+	err = plantillas.WriteEscPosSvg(&svg, prn, mm)
+	assert.NoError(t, err)
+	s := svg.String()
+	assert.True(t, strings.HasPrefix(s, `<svg xmlns="http://www.w3.org/2000/svg" width="576"`))
+	assert.True(t, strings.HasSuffix(s, "</svg>\n"))
+	assert.Contains(t, s, `font-weight="bold" xml:space="preserve">A&lt;B &amp; C</text>`)
+	assert.Contains(t, s, `<text transform="matrix(-1 0 0 -1 48 `)
+	assert.Equal(t, 1, strings.Count(s, "<line "))
+	assert.Contains(t, s, "<path d=\"M")
+}
+
+func ExampleWriteEscPosPng() {
+	// Cargar plantilla
+	plantilla, err := os.ReadFile("plantilla.escpos")
+	errores.PanicIfError(err)
+	// Fusionar plantilla con estructura factura
+	f, err := plantillas.MergeEscPosTemplate("escpos", string(plantilla), factura, "/assets", formato.DMA, formato.EUR)
+	errores.PanicIfError(err)
+	// Convertir la plantilla fusionada a fichero esc/pos binario
+	prn, mm, err := plantillas.GenerateEscPos(f, plantillas.EPSON)
+	errores.PanicIfError(err)
+	// Generar la vista previa en PNG
+	var out bytes.Buffer
+	err = plantillas.WriteEscPosPng(&out, prn, mm)
+	errores.PanicIfError(err)
+	os.WriteFile("recibo.png", out.Bytes(), 0666)
+	img, err := png.Decode(&out)
+	errores.PanicIfError(err)
+	fmt.Println("Generado fichero recibo.png de", img.Bounds().Dx(), "puntos de ancho")
+	// Output: Generado fichero recibo.png de 576 puntos de ancho
+}
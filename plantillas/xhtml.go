@@ -8,7 +8,8 @@ Las plantillas soportan la sintaxis estándar de GO y además los siguientes att
   * th:text="content" => reemplaza el contenido del tag
   * th:attr="value"   => reemplaza el valor del atributo
 
-Se soportan las funciones de formato DATETIME, DATE, TIME, PRICE y BR.
+Se soportan las funciones de formato DATETIME, DATE, TIME, PRICE y BR, y las de desglose de impuestos VAT y VATINC:
+{{with VAT .Lines "Price" .VatRate}}{{range .Tipos}}...{{PRICE .Base}}...{{end}}{{end}}
 
 Ejemplo de plantillla en https://github.com/horus-es/go-util/blob/main/plantillas/plantilla.html
 
@@ -53,45 +54,6 @@ func MergeXhtmlTemplate(name, xhtml string, datos any, assets string, ff formato
 		return "", err
 	}
 	var funciones = template.FuncMap{
-		"DATETIME": func(x any) string {
-			switch t := x.(type) {
-			case time.Time:
-				return formato.PrintFechaHora(t, ff)
-			case string:
-				t2, err := formato.ParseFechaHora(t, ff)
-				if err == nil {
-					return formato.PrintFechaHora(t2, ff)
-				}
-			}
-			errores.PanicIfTrue(true, "fecha %q no soportada", x)
-			return ""
-		},
-		"DATE": func(x any) string {
-			switch t := x.(type) {
-			case time.Time:
-				return formato.PrintFecha(t, ff)
-			case string:
-				t2, err := formato.ParseFechaHora(t, ff)
-				if err == nil {
-					return formato.PrintFecha(t2, ff)
-				}
-			}
-			errores.PanicIfTrue(true, "fecha %q no soportada", x)
-			return ""
-		},
-		"TIME": func(x any) string {
-			switch t := x.(type) {
-			case time.Time:
-				return formato.PrintHora(t, false)
-			case string:
-				t2, err := formato.ParseFechaHora(t, ff)
-				if err == nil {
-					return formato.PrintHora(t2, false)
-				}
-			}
-			errores.PanicIfTrue(true, "fecha %q no soportada", x)
-			return ""
-		},
 		"PRICE": func(f float64) string {
 			return formato.PrintPrecio(f, fp, formato.DECIMALES_DEFECTO)
 		},
@@ -104,6 +66,12 @@ func MergeXhtmlTemplate(name, xhtml string, datos any, assets string, ff formato
 			return template.HTML(strings.Join(lineas, "<br/>"))
 		},
 	}
+	for nombre, f := range funcionesFecha(ff) {
+		funciones[nombre] = f
+	}
+	for nombre, f := range funcionesImpuestos(fp) {
+		funciones[nombre] = f
+	}
 	var opt string
 	if reflect.TypeOf(datos).Kind() == reflect.Map {
 		// En los mapas se permite que falten campos
@@ -300,6 +268,17 @@ func SendXhtmlMail(name, xhtml string, datos any, assets string, ff formato.Fech
 	if err != nil {
 		return err
 	}
+	return SendHtmlMail(body, adjuntos, from, to, subject, bcc, replyto, host, port, username, password)
+}
+
+// Envia un correo a partir de un documento HTML, p.e. una plantilla XHTML ya fusionada con MergeXhtmlTemplate. Parámetros:
+//   - body: documento HTML
+//   - adjuntos: ficheros a adjuntar
+//   - from,to,subject,bcc,replyto: parámetros MIME
+//   - host,port,username,password: parámtros SMTP. La contraseña debe ir codificada en base64.
+func SendHtmlMail(body string, adjuntos []string,
+	from, to, subject string, bcc, replyto []string,
+	host string, port int, username, password string) error {
 
 	// css-inline: mejora la compatibilidad de los clientes de email
 	bodycss, err := premailer.NewPremailerFromBytes([]byte(body), premailer.NewOptions())
@@ -0,0 +1,141 @@
+// Funciones de gestión para POSTGRESQL usando el driver pgxpool
+package postgres
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/horus-es/go-util/v3/errores"
+	"github.com/horus-es/go-util/v3/misc"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Intervalo entre intentos mientras se espera un bloqueo
+const intervaloBloqueo = 100 * time.Millisecond
+
+// Bloqueo consultivo (advisory lock) de sesión. Retiene una conexión del pool hasta que se libera.
+type AdvisoryLock struct {
+	nombre string
+	clave  int64
+	conn   *pgxpool.Conn
+}
+
+// Calcula la clave de un bloqueo consultivo a partir de su nombre (FNV-1a de 64 bits)
+func LockKey(nombre string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(nombre))
+	return int64(h.Sum64())
+}
+
+// Intenta obtener un bloqueo consultivo de sesión sin esperar.
+// Devuelve nil si el bloqueo lo tiene otra sesión. El bloqueo se debe liberar con Release.
+func TryAdvisoryLock(c *gin.Context, nombre string) *AdvisoryLock {
+	return AcquireAdvisoryLock(c, nombre, 0)
+}
+
+// Obtiene un bloqueo consultivo de sesión, esperando como máximo timeout.
+// Devuelve nil si vence el timeout. El bloqueo se debe liberar con Release.
+func AcquireAdvisoryLock(c *gin.Context, nombre string, timeout time.Duration) *AdvisoryLock {
+	ts := time.Now()
+	conn, err := dbPool.Acquire(dbCtx)
+	errores.PanicIfError(err, "AcquireAdvisoryLock")
+	lock := &AdvisoryLock{nombre: nombre, clave: LockKey(nombre), conn: conn}
+	const query = "select pg_try_advisory_lock($1)"
+	ok := esperaBloqueo(func() bool {
+		var obtenido bool
+		err := conn.QueryRow(dbCtx, query, lock.clave).Scan(&obtenido)
+		if err != nil {
+			conn.Release()
+		}
+		errores.PanicIfError(err, "AcquireAdvisoryLock: %s", reemplaza(query, lock.clave))
+		return obtenido
+	}, timeout)
+	logBloqueo(c, reemplaza(query, lock.clave), nombre, ok, ts)
+	if !ok {
+		conn.Release()
+		return nil
+	}
+	return lock
+}
+
+// Libera un bloqueo consultivo de sesión y devuelve la conexión al pool.
+// Si no se puede liberar, la conexión se cierra en lugar de devolverla al pool, ya que podría seguir reteniendo el bloqueo.
+func (lock *AdvisoryLock) Release(c *gin.Context) {
+	if lock == nil || lock.conn == nil {
+		return
+	}
+	conn := lock.conn
+	lock.conn = nil
+	const query = "select pg_advisory_unlock($1)"
+	var liberado bool
+	err := conn.QueryRow(dbCtx, query, lock.clave).Scan(&liberado)
+	limpio := reemplaza(query, lock.clave) + " -- " + lock.nombre
+	if err != nil || !liberado {
+		// Al cerrar la sesión, PostgreSQL libera sus bloqueos consultivos
+		conn.Hijack().Close(dbCtx)
+	}
+	errores.PanicIfError(err, "AdvisoryLock.Release: %s", limpio)
+	errores.PanicIfTrue(!liberado, "AdvisoryLock.Release: Bloqueo no liberado: %s", limpio)
+	conn.Release()
+	dbLog.Infof(c, limpio)
+}
+
+// Intenta obtener un bloqueo consultivo en la transacción actual sin esperar.
+// Devuelve false si el bloqueo lo tiene otra sesión.
+// El bloqueo se libera automáticamente al finalizar la transacción (CommitTX o RollbackTX, p.e. en MiddlewareTransaction).
+// Panic si no hay una transacción en curso.
+func TryAdvisoryLockTX(c *gin.Context, nombre string) bool {
+	return AcquireAdvisoryLockTX(c, nombre, 0)
+}
+
+// Obtiene un bloqueo consultivo en la transacción actual, esperando como máximo timeout.
+// Devuelve false si vence el timeout.
+// El bloqueo se libera automáticamente al finalizar la transacción (CommitTX o RollbackTX, p.e. en MiddlewareTransaction).
+// Panic si no hay una transacción en curso.
+func AcquireAdvisoryLockTX(c *gin.Context, nombre string, timeout time.Duration) bool {
+	ts := time.Now()
+	tx, ok := dbTxs.Load(misc.GetGID())
+	errores.PanicIfTrue(!ok, "AcquireAdvisoryLockTX: No hay transacción en curso")
+	clave := LockKey(nombre)
+	const query = "select pg_try_advisory_xact_lock($1)"
+	limpio := reemplaza(query, clave)
+	ok = esperaBloqueo(func() bool {
+		var obtenido bool
+		err := tx.(pgx.Tx).QueryRow(dbCtx, query, clave).Scan(&obtenido)
+		errores.PanicIfError(err, "AcquireAdvisoryLockTX: %s", limpio)
+		return obtenido
+	}, timeout)
+	logBloqueo(c, limpio, nombre, ok, ts)
+	return ok
+}
+
+// Reintenta obtener un bloqueo hasta conseguirlo o hasta que venza el timeout
+func esperaBloqueo(intento func() bool, timeout time.Duration) bool {
+	limite := time.Now().Add(timeout)
+	for {
+		if intento() {
+			return true
+		}
+		if time.Now().Add(intervaloBloqueo).After(limite) {
+			return false
+		}
+		time.Sleep(intervaloBloqueo)
+	}
+}
+
+// Registra el resultado de un intento de bloqueo
+func logBloqueo(c *gin.Context, limpio, nombre string, ok bool, ts time.Time) {
+	limpio += " -- " + nombre
+	if ok {
+		limpio += ": obtenido"
+	} else {
+		limpio += ": ocupado"
+	}
+	if inTest {
+		dbLog.Infof(c, limpio)
+	} else {
+		dbLog.Infof(c, "%s (%dms)", limpio, time.Since(ts).Milliseconds())
+	}
+}
@@ -0,0 +1,43 @@
+package postgres_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/horus-es/go-util/v3/logger"
+	"github.com/horus-es/go-util/v3/postgres"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockKey(t *testing.T) {
+	assert.Equal(t, postgres.LockKey("facturacion"), postgres.LockKey("facturacion"))
+	assert.NotEqual(t, postgres.LockKey("facturacion"), postgres.LockKey("tickets"))
+	assert.Equal(t, int64(-3750763034362895579), postgres.LockKey(""))
+}
+
+func TestAdvisoryLockTXPanic(t *testing.T) {
+	defer func() { recover() }()
+	postgres.TryAdvisoryLockTX(nil, "facturacion")
+	t.Error("Sin pánico sin transacción")
+}
+
+func ExampleTryAdvisoryLock() {
+	lock := postgres.TryAdvisoryLock(nil, "facturacion")
+	if lock == nil {
+		logger.Infof(nil, "Otra instancia está facturando")
+		return
+	}
+	defer lock.Release(nil)
+	// Mientras tanto otras sesiones no pueden obtener el bloqueo
+	postgres.StartTX(nil)
+	ocupado := !postgres.AcquireAdvisoryLockTX(nil, "facturacion", 200*time.Millisecond)
+	postgres.CommitTX(nil)
+	logger.Infof(nil, "Ocupado: %v", ocupado)
+	// Output:
+	// INFO: select pg_try_advisory_lock(-688267248664544638) -- facturacion: obtenido
+	// INFO: StartTX
+	// INFO: select pg_try_advisory_xact_lock(-688267248664544638) -- facturacion: ocupado
+	// INFO: CommitTX
+	// INFO: Ocupado: true
+	// INFO: select pg_advisory_unlock(-688267248664544638) -- facturacion
+}
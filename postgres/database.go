@@ -250,6 +250,7 @@ func getArrayEspecial(especiales []string, campo string) []string {
 //	campo=expresion => se inserta este campo con esta expresion.
 //
 // Por ejemplo si especial es "-inicio","final=now()","parking=null" se excluye inicio, final=hora actual y parking=nulo.
+// Los valores de las columnas sensibles (ver SetSensitivePatterns y SetSensitiveColumns) se ocultan en los logs.
 // Devuelve el id de la fila insertada.
 func InsertRow(c *gin.Context, src any, especiales ...string) string {
 	mapaEspecial, excludeAll := getMapaEspecial(especiales)
@@ -283,6 +284,8 @@ func InsertRow(c *gin.Context, src any, especiales ...string) string {
 	errores.PanicIfTrue(n == 0, "InsertRow: No hay campos que insertar")
 	query += ") values"
 	params := make([]any, p)
+	ocultos := map[int]bool{}
+	var prefijos, expresiones []string
 	n = 0
 	p = 0
 	for _, campo := range campos {
@@ -304,13 +307,19 @@ func InsertRow(c *gin.Context, src any, especiales ...string) string {
 			params[p] = valor.FieldByName(campo.Name).Interface()
 			p++
 			query += "$" + strconv.Itoa(p)
+			ocultos[p] = isSensitiveField(campo, fieldName)
 		} else {
 			query += especial
+			if isSensitiveField(campo, fieldName) {
+				prefijos = append(prefijos, "")
+				expresiones = append(expresiones, especial)
+			}
 		}
 
 	}
 	query += ") returning id"
-	limpio := reemplaza(query, params...)
+	limpio := reemplazaOcultando(query, ocultos, params...)
+	limpio = ocultaExpresiones(limpio, strings.Index(limpio, ") values ("), prefijos, expresiones)
 	var row pgx.Row
 	tx, ok := dbTxs.Load(misc.GetGID())
 	if ok {
@@ -338,6 +347,7 @@ func InsertRow(c *gin.Context, src any, especiales ...string) string {
 //	campo=expresion => se actualiza este campo con esta expresion.
 //
 // Por ejemplo si especial es "-inicio","final=now()","parking=null" se excluye inicio, final=hora actual, parking=nulo y la tabla a actualizar es otra
+// Los valores de las columnas sensibles (ver SetSensitivePatterns y SetSensitiveColumns) se ocultan en los logs.
 // Panic si la fila no existe
 func UpdateRow(c *gin.Context, src any, especiales ...string) {
 	mapaEspecial, excludeAll := getMapaEspecial(especiales)
@@ -377,6 +387,8 @@ func UpdateRow(c *gin.Context, src any, especiales ...string) {
 	p++
 	query += " where id=$" + strconv.Itoa(p)
 	params := make([]any, p)
+	ocultos := map[int]bool{}
+	var prefijos, expresiones []string
 	var id any
 	n = 0
 	p = 0
@@ -390,14 +402,24 @@ func UpdateRow(c *gin.Context, src any, especiales ...string) {
 		if especial == "-" || (excludeAll && !ok) {
 			continue
 		}
-		if especial == "" {
+		switch especial {
+		case "":
 			params[p] = valor.FieldByName(campo.Name).Interface()
 			p++
+			ocultos[p] = isSensitiveField(campo, fieldName)
+		case "[]":
+			// los elementos de arrays no se ocultan
+		default:
+			if isSensitiveField(campo, fieldName) {
+				prefijos = append(prefijos, fieldName+"=")
+				expresiones = append(expresiones, especial)
+			}
 		}
 	}
 	errores.PanicIfTrue(id == nil, "UpdateRow: Falta el campo 'id'")
 	params[p] = id
-	limpio := reemplaza(query, params...)
+	limpio := reemplazaOcultando(query, ocultos, params...)
+	limpio = ocultaExpresiones(limpio, 0, prefijos, expresiones)
 
 	var tag pgconn.CommandTag
 	var err error
@@ -439,10 +461,21 @@ func DeleteRow(c *gin.Context, id string, table string) {
 // auxiliar reemplaza()
 var singleSpacePattern = regexp.MustCompile(`\s+`)
 
-// Reemplaza parámetros y sanitiza la orden, a efectos de mostrarla en los logs
+// Reemplaza parámetros y sanitiza la orden, a efectos de mostrarla en los logs.
+// Los parámetros de columnas sensibles se sustituyen por una máscara.
 func reemplaza(query string, params ...any) string {
+	return reemplazaOcultando(query, nil, params...)
+}
+
+// Igual que reemplaza, pero además enmascara los parámetros indicados en ocultos (numerados desde 1)
+func reemplazaOcultando(query string, ocultos map[int]bool, params ...any) string {
 	query = singleSpacePattern.ReplaceAllString(strings.TrimSpace(query), " ")
+	sensibles := parametrosSensibles(query)
 	for k := len(params); k > 0; k-- {
+		if ocultos[k] || sensibles[k] {
+			query = strings.ReplaceAll(query, "$"+strconv.Itoa(k), mascara)
+			continue
+		}
 		var valor string
 		switch v := params[k-1].(type) {
 		case string:
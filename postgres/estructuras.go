@@ -0,0 +1,164 @@
+// Funciones de gestión para POSTGRESQL usando el driver pgxpool
+package postgres
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"unicode"
+
+	"github.com/georgysavva/scany/v2/dbscan"
+	"github.com/gin-gonic/gin"
+)
+
+// Columna de una tabla, tal y como se lee de information_schema
+type ColumnaSQL struct {
+	Tabla   string // Nombre de la tabla
+	Columna string // Nombre de la columna
+	Tipo    string // Tipo postgres (udt_name), p.e. uuid, text, timestamp, _text (array de text)
+	Nulo    bool   // Admite nulos
+}
+
+// Genera el código fuente Go de los structs T_tabla de las tablas de un esquema de la base de datos,
+// compatibles con InsertRow, UpdateRow y las funciones de consulta. Si no se indican tablas, se generan todas las del esquema.
+// Normalmente se usa mediante el comando cmd/pgstructs desde una directiva go:generate.
+func GenerateStructs(c *gin.Context, pkg, schema string, tablas ...string) ([]byte, error) {
+	var columnas []ColumnaSQL
+	query := `select c.table_name as tabla, c.column_name as columna, c.udt_name as tipo, c.is_nullable='YES' as nulo
+		from information_schema.columns c
+		join information_schema.tables t on t.table_schema=c.table_schema and t.table_name=c.table_name
+		where c.table_schema=$1 and t.table_type='BASE TABLE'`
+	if len(tablas) > 0 {
+		query += " and c.table_name=any($2) order by c.table_name, c.ordinal_position"
+		GetOrderedRows(c, &columnas, query, schema, tablas)
+	} else {
+		query += " order by c.table_name, c.ordinal_position"
+		GetOrderedRows(c, &columnas, query, schema)
+	}
+	if len(columnas) == 0 {
+		return nil, fmt.Errorf("GenerateStructs: no hay tablas en el esquema %q", schema)
+	}
+	return FormatStructs(pkg, columnas)
+}
+
+// Genera el código fuente Go de los structs T_tabla a partir de una lista de columnas, agrupadas por tabla y en orden.
+// Los nombres de los campos son los que SnakeCaseMapper convierte de nuevo en el nombre de la columna.
+// Los tipos son los nativos de Go para las columnas no nulas y los de pgtype para las que admiten nulos,
+// salvo las fechas, horas e intervalos, que siempre usan pgtype. La columna id es siempre string.
+func FormatStructs(pkg string, columnas []ColumnaSQL) ([]byte, error) {
+	var cuerpo bytes.Buffer
+	pgtype := false
+	tabla := ""
+	for _, col := range columnas {
+		if col.Tabla != tabla {
+			if tabla != "" {
+				cuerpo.WriteString("}\n\n")
+			}
+			tabla = col.Tabla
+			fmt.Fprintf(&cuerpo, "// Tabla %s\ntype T_%s struct {\n", tabla, tabla)
+		}
+		tipo, comentario := tipoGo(col)
+		if strings.HasPrefix(tipo, "pgtype.") || strings.HasPrefix(tipo, "[]pgtype.") {
+			pgtype = true
+		}
+		nombre := nombreCampo(col.Columna)
+		if dbscan.SnakeCaseMapper(nombre) != col.Columna {
+			fmt.Fprintf(&cuerpo, "\t%s %s `db:%q`", nombre, tipo, col.Columna)
+			comentario = strings.TrimSpace("Nombre no compatible con InsertRow y UpdateRow. " + comentario)
+		} else {
+			fmt.Fprintf(&cuerpo, "\t%s %s", nombre, tipo)
+		}
+		if comentario != "" {
+			cuerpo.WriteString(" // " + comentario)
+		}
+		cuerpo.WriteString("\n")
+	}
+	if tabla != "" {
+		cuerpo.WriteString("}\n")
+	}
+	var fuente bytes.Buffer
+	fuente.WriteString("// Code generated by pgstructs. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&fuente, "package %s\n\n", pkg)
+	if pgtype {
+		fuente.WriteString("import \"github.com/jackc/pgx/v5/pgtype\"\n\n")
+	}
+	fuente.Write(cuerpo.Bytes())
+	return format.Source(fuente.Bytes())
+}
+
+// Convierte el nombre de una columna en el nombre de un campo: operador_id => OperadorID
+func nombreCampo(columna string) string {
+	var nombre strings.Builder
+	for _, parte := range strings.Split(columna, "_") {
+		if parte == "" {
+			continue
+		}
+		if parte == "id" {
+			nombre.WriteString("ID")
+			continue
+		}
+		r := []rune(parte)
+		r[0] = unicode.ToUpper(r[0])
+		nombre.WriteString(string(r))
+	}
+	result := nombre.String()
+	if result == "" || !unicode.IsLetter([]rune(result)[0]) {
+		result = "X" + result
+	}
+	return result
+}
+
+// Tipos Go de las columnas no nulas y nulas
+var tiposGo = map[string][2]string{
+	"uuid":        {"pgtype.UUID", "pgtype.UUID"},
+	"text":        {"string", "pgtype.Text"},
+	"varchar":     {"string", "pgtype.Text"},
+	"bpchar":      {"string", "pgtype.Text"},
+	"citext":      {"string", "pgtype.Text"},
+	"name":        {"string", "pgtype.Text"},
+	"bool":        {"bool", "pgtype.Bool"},
+	"int2":        {"int16", "pgtype.Int2"},
+	"int4":        {"int", "pgtype.Int4"},
+	"int8":        {"int64", "pgtype.Int8"},
+	"float4":      {"float32", "pgtype.Float4"},
+	"float8":      {"float64", "pgtype.Float8"},
+	"numeric":     {"float64", "pgtype.Float8"},
+	"date":        {"pgtype.Date", "pgtype.Date"},
+	"time":        {"pgtype.Time", "pgtype.Time"},
+	"timestamp":   {"pgtype.Timestamp", "pgtype.Timestamp"},
+	"timestamptz": {"pgtype.Timestamptz", "pgtype.Timestamptz"},
+	"interval":    {"pgtype.Interval", "pgtype.Interval"},
+	"json":        {"[]byte", "[]byte"},
+	"jsonb":       {"[]byte", "[]byte"},
+	"bytea":       {"[]byte", "[]byte"},
+	"_text":       {"[]string", "[]string"},
+	"_varchar":    {"[]string", "[]string"},
+	"_uuid":       {"[]pgtype.UUID", "[]pgtype.UUID"},
+	"_bool":       {"[]bool", "[]bool"},
+	"_int2":       {"[]int16", "[]int16"},
+	"_int4":       {"[]int32", "[]int32"},
+	"_int8":       {"[]int64", "[]int64"},
+	"_float4":     {"[]float32", "[]float32"},
+	"_float8":     {"[]float64", "[]float64"},
+	"_numeric":    {"[]float64", "[]float64"},
+}
+
+// Determina el tipo Go de una columna. Los tipos desconocidos (p.e. enumerados) se tratan como texto, indicándolo en el comentario.
+func tipoGo(col ColumnaSQL) (tipo, comentario string) {
+	if col.Columna == "id" {
+		return "string", ""
+	}
+	k := 0
+	if col.Nulo {
+		k = 1
+	}
+	tipos, ok := tiposGo[col.Tipo]
+	if !ok {
+		if strings.HasPrefix(col.Tipo, "_") {
+			return "[]string", "Tipo " + col.Tipo
+		}
+		return tiposGo["text"][k], "Tipo " + col.Tipo
+	}
+	return tipos[k], ""
+}
@@ -0,0 +1,56 @@
+package postgres_test
+
+import (
+	"fmt"
+
+	"github.com/horus-es/go-util/v3/postgres"
+)
+
+func ExampleFormatStructs() {
+	fuente, err := postgres.FormatStructs("modelo", []postgres.ColumnaSQL{
+		{Tabla: "personal", Columna: "id", Tipo: "uuid"},
+		{Tabla: "personal", Columna: "operador", Tipo: "uuid"},
+		{Tabla: "personal", Columna: "codigo", Tipo: "text"},
+		{Tabla: "personal", Columna: "hash", Tipo: "text", Nulo: true},
+		{Tabla: "personal", Columna: "activo", Tipo: "bool"},
+		{Tabla: "personal", Columna: "alta", Tipo: "timestamp"},
+		{Tabla: "tarifas", Columna: "id", Tipo: "uuid"},
+		{Tabla: "tarifas", Columna: "precio_iva21", Tipo: "numeric"},
+		{Tabla: "tarifas", Columna: "descuento", Tipo: "float8", Nulo: true},
+		{Tabla: "tarifas", Columna: "duracion", Tipo: "interval"},
+		{Tabla: "tarifas", Columna: "dias", Tipo: "_int4"},
+		{Tabla: "tarifas", Columna: "modo", Tipo: "modo_tarifa"},
+		{Tabla: "tarifas", Columna: "Validez", Tipo: "date", Nulo: true},
+	})
+	if err != nil {
+		fmt.Println(err)
+	}
+	fmt.Print(string(fuente))
+	// Output:
+	// // Code generated by pgstructs. DO NOT EDIT.
+	//
+	// package modelo
+	//
+	// import "github.com/jackc/pgx/v5/pgtype"
+	//
+	// // Tabla personal
+	// type T_personal struct {
+	// 	ID       string
+	// 	Operador pgtype.UUID
+	// 	Codigo   string
+	// 	Hash     pgtype.Text
+	// 	Activo   bool
+	// 	Alta     pgtype.Timestamp
+	// }
+	//
+	// // Tabla tarifas
+	// type T_tarifas struct {
+	// 	ID          string
+	// 	PrecioIva21 float64
+	// 	Descuento   pgtype.Float8
+	// 	Duracion    pgtype.Interval
+	// 	Dias        []int32
+	// 	Modo        string      // Tipo modo_tarifa
+	// 	Validez     pgtype.Date `db:"Validez"` // Nombre no compatible con InsertRow y UpdateRow.
+	// }
+}
@@ -0,0 +1,138 @@
+// Funciones de gestión para POSTGRESQL usando el driver pgxpool
+package postgres
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Valor que sustituye en los logs a los parámetros sensibles
+const mascara = "'***'"
+
+var sensiblesMutex sync.RWMutex
+var patronesSensibles = []*regexp.Regexp{regexp.MustCompile(`(?i)password`), regexp.MustCompile(`(?i)token`)}
+var columnasSensibles = map[string]bool{}
+
+// Establece los patrones (expresiones regulares) de los nombres de columna cuyos valores se ocultan en los logs.
+// No se distinguen mayúsculas de minúsculas. Por defecto son "password" y "token".
+// Sin parámetros se eliminan todos los patrones. Panic si algún patrón no es una expresión regular válida.
+func SetSensitivePatterns(patrones ...string) {
+	lista := []*regexp.Regexp{}
+	for _, p := range patrones {
+		lista = append(lista, regexp.MustCompile("(?i)"+p))
+	}
+	sensiblesMutex.Lock()
+	defer sensiblesMutex.Unlock()
+	patronesSensibles = lista
+}
+
+// Establece las columnas cuyos valores se ocultan en los logs, además de las que coincidan con los patrones.
+// Sin parámetros se eliminan todas las columnas. Los campos de los structs también se pueden marcar con el tag `log:"mask"`.
+func SetSensitiveColumns(columnas ...string) {
+	lista := map[string]bool{}
+	for _, c := range columnas {
+		lista[strings.ToLower(c)] = true
+	}
+	sensiblesMutex.Lock()
+	defer sensiblesMutex.Unlock()
+	columnasSensibles = lista
+}
+
+// Determina si los valores de una columna se deben ocultar en los logs
+func isSensitive(columna string) bool {
+	columna = strings.ToLower(columna)
+	if k := strings.LastIndexByte(columna, '.'); k >= 0 {
+		// Columna cualificada: tabla.columna
+		columna = columna[k+1:]
+	}
+	sensiblesMutex.RLock()
+	defer sensiblesMutex.RUnlock()
+	if columnasSensibles[columna] {
+		return true
+	}
+	for _, p := range patronesSensibles {
+		if p.MatchString(columna) {
+			return true
+		}
+	}
+	return false
+}
+
+// Determina si los valores de un campo de un struct se deben ocultar en los logs
+func isSensitiveField(campo reflect.StructField, columna string) bool {
+	return campo.Tag.Get("log") == "mask" || isSensitive(columna)
+}
+
+// auxiliar parametrosSensibles()
+var reComparacionSensible = regexp.MustCompile(`(?i)([a-z_][a-z0-9_.]*)\s*(?:=|<>|!=|\blike\b|\bilike\b)\s*\$([0-9]+)\b`)
+var reInsertSensible = regexp.MustCompile(`(?is)^insert\s+into\s+[^\s(]+\s*\(([^)]*)\)\s*values\s*\((.*)\)`)
+
+// Determina los parámetros ($n) de una orden SQL que corresponden a columnas sensibles.
+// Reconoce las comparaciones (columna=$n) y las listas de un insert (insert into tabla (columnas) values (valores)).
+func parametrosSensibles(query string) map[int]bool {
+	result := map[int]bool{}
+	for _, m := range reComparacionSensible.FindAllStringSubmatch(query, -1) {
+		if isSensitive(m[1]) {
+			n, _ := strconv.Atoi(m[2])
+			result[n] = true
+		}
+	}
+	m := reInsertSensible.FindStringSubmatch(query)
+	if m != nil {
+		columnas := strings.Split(m[1], ",")
+		valores := separaValores(m[2])
+		for k := 0; k < len(columnas) && k < len(valores); k++ {
+			v := strings.TrimSpace(valores[k])
+			if !strings.HasPrefix(v, "$") || !isSensitive(strings.TrimSpace(columnas[k])) {
+				continue
+			}
+			n, err := strconv.Atoi(v[1:])
+			if err == nil {
+				result[n] = true
+			}
+		}
+	}
+	return result
+}
+
+// Separa una lista de valores SQL por las comas que no estén entre paréntesis ni entre comillas
+func separaValores(lista string) []string {
+	result := []string{}
+	nivel := 0
+	comillas := false
+	p := 0
+	for k, r := range lista {
+		switch {
+		case r == '\'':
+			comillas = !comillas
+		case comillas:
+		case r == '(':
+			nivel++
+		case r == ')':
+			nivel--
+		case r == ',' && nivel == 0:
+			result = append(result, lista[p:k])
+			p = k + 1
+		}
+	}
+	return append(result, lista[p:])
+}
+
+// Oculta en una orden ya sanitizada las expresiones especiales de las columnas sensibles, buscándolas en orden a partir de la posición desde.
+// Cada expresión va precedida por su prefijo (p.e. "campo="), que se mantiene.
+func ocultaExpresiones(limpio string, desde int, prefijos, expresiones []string) string {
+	for k, e := range expresiones {
+		e = prefijos[k] + singleSpacePattern.ReplaceAllString(strings.TrimSpace(e), " ")
+		n := strings.Index(limpio[desde:], e)
+		if n < 0 {
+			continue
+		}
+		n += desde
+		limpio = limpio[:n] + prefijos[k] + mascara + limpio[n+len(e):]
+		desde = n + len(prefijos[k]) + len(mascara)
+	}
+	return limpio
+}
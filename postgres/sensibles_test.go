@@ -0,0 +1,63 @@
+package postgres_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/horus-es/go-util/v3/postgres"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+// Tabla inexistente: las órdenes fallan siempre y el mensaje del panic contiene la orden tal y como aparece en el log
+type T_credenciales struct {
+	ID       string
+	Usuario  string
+	Password string
+	Pin      string `log:"mask"`
+	Hash     pgtype.Text
+}
+
+// Ejecuta f y devuelve el mensaje del panic
+func capturaPanic(f func()) (msg string) {
+	defer func() {
+		msg = fmt.Sprint(recover())
+	}()
+	f()
+	return
+}
+
+func TestSensitiveInsertRow(t *testing.T) {
+	u := T_credenciales{Usuario: "pablo7", Password: "top6ecret", Pin: "1234"}
+	msg := capturaPanic(func() { postgres.InsertRow(nil, u, "hash='zecreto2023'") })
+	assert.Contains(t, msg, "insert into credenciales (usuario,password,pin,hash) values ('pablo7','***','***','zecreto2023') returning id")
+	postgres.SetSensitiveColumns("hash")
+	defer postgres.SetSensitiveColumns()
+	defer postgres.SetSensitivePatterns("password", "token")
+	msg = capturaPanic(func() { postgres.InsertRow(nil, u, "hash=md5('zecreto2023')") })
+	assert.Contains(t, msg, "insert into credenciales (usuario,password,pin,hash) values ('pablo7','***','***','***') returning id")
+	assert.NotContains(t, msg, "zecreto2023")
+	postgres.SetSensitivePatterns()
+	msg = capturaPanic(func() { postgres.InsertRow(nil, u, "-hash") })
+	assert.Contains(t, msg, "insert into credenciales (usuario,password,pin) values ('pablo7','top6ecret','***') returning id")
+}
+
+func TestSensitiveUpdateRow(t *testing.T) {
+	u := T_credenciales{ID: UUIDnoexiste, Usuario: "pablo7", Password: "top6ecret", Pin: "1234"}
+	msg := capturaPanic(func() { postgres.UpdateRow(nil, u, "-hash") })
+	assert.Contains(t, msg, "update credenciales set usuario='pablo7',password='***',pin='***' where id='"+UUIDnoexiste+"'")
+	msg = capturaPanic(func() { postgres.UpdateRow(nil, u, "password=crypt('top6ecret', gen_salt('bf'))", "pin") })
+	assert.Contains(t, msg, "update credenciales set password='***',pin='***' where id='"+UUIDnoexiste+"'")
+}
+
+func TestSensitiveQuery(t *testing.T) {
+	var u T_credenciales
+	msg := capturaPanic(func() {
+		postgres.GetOneOrZeroRows(nil, &u, "select * from credenciales where usuario=$1 and password = $2", "pablo7", "top6ecret")
+	})
+	assert.Contains(t, msg, "select * from credenciales where usuario='pablo7' and password = '***'")
+	msg = capturaPanic(func() {
+		postgres.GetOneRow(nil, &u.ID, "insert into credenciales (usuario,password,hash) values ($1,$2,md5($1)) returning id", "pablo7", "top6ecret")
+	})
+	assert.Contains(t, msg, "insert into credenciales (usuario,password,hash) values ('pablo7','***',md5('pablo7')) returning id")
+}